@@ -2,25 +2,25 @@
 package aggregator
 
 import (
+	"math/big"
 	"reflect"
-	"sync"
-	"syscall"
 	"time"
 )
 
-type record struct {
-	count  int64
-	max    interface{}
-	min    interface{}
-	sum    interface{}
-	time0  time.Time
-	timeN  time.Time
+// entry adapts a typed record to the interface{} API. Values are widened to a
+// float64, int64 or uint64 record and value0 retains the type of the first
+// value inserted.
+type entry struct {
+	anyRecord
 	value0 interface{}
 }
 
+// Aggregator aggregates values of any numeric type by key. It is retained for
+// compatibility; new code should use TypedAggregator. Values of custom types
+// must implement Value, except for complex and *big.Int values which are
+// supported natively.
 type Aggregator struct {
-	db map[interface{}]*record
-	mu *sync.RWMutex
+	*core[interface{}, interface{}, *entry, Aggregate]
 }
 
 type Aggregate struct {
@@ -31,115 +31,39 @@ type Aggregate struct {
 	Sum interface{}
 }
 
-func NewAggregator() *Aggregator {
-	return &Aggregator{db: make(map[interface{}]*record), mu: &sync.RWMutex{}}
+// Sample is a value to insert into an Aggregator with InsertBatch. Value is
+// the sum of Weight observations; a Weight of zero is the same as one.
+type Sample struct {
+	Key    interface{}
+	Value  interface{}
+	Weight int64
 }
 
-func (a *Aggregator) add(x, y interface{}) interface{} {
-	var sum interface{}
-
-	switch x.(type) {
-	case float64:
-		sum = x.(float64) + y.(float64)
-	case int64:
-		sum = x.(int64) + y.(int64)
-	case uint64:
-		sum = x.(uint64) + y.(uint64)
+func sampleWeight(weight int64) int64 {
+	if weight == 0 {
+		return 1
 	}
-
-	return sum
+	return weight
 }
 
-// Compare two integer interfaces values:
-//   -1: x <  y
-//    0: x == y
-//    1: x >  y
-func (a *Aggregator) compare(x interface{}, y interface{}) int {
-	res := 0
-
-	switch x.(type) {
-	case float32:
-		if x.(float32) < y.(float32) {
-			res = -1
-		} else if x.(float32) > y.(float32) {
-			res = 1
-		}
-	case float64:
-		if x.(float64) < y.(float64) {
-			res = -1
-		} else if x.(float64) > y.(float64) {
-			res = 1
-		}
-	case int:
-		if x.(int) < y.(int) {
-			res = -1
-		} else if x.(int) > y.(int) {
-			res = 1
-		}
-	case int8:
-		if x.(int8) < y.(int8) {
-			res = -1
-		} else if x.(int8) > y.(int8) {
-			res = 1
-		}
-	case int16:
-		if x.(int16) < y.(int16) {
-			res = -1
-		} else if x.(int16) > y.(int16) {
-			res = 1
-		}
-	case int32:
-		if x.(int32) < y.(int32) {
-			res = -1
-		} else if x.(int32) > y.(int32) {
-			res = 1
-		}
-	case int64:
-		if x.(int64) < y.(int64) {
-			res = -1
-		} else if x.(int64) > y.(int64) {
-			res = 1
-		}
-	case uint:
-		if x.(uint) < y.(uint) {
-			res = -1
-		} else if x.(uint) > y.(uint) {
-			res = 1
-		}
-	case uint8:
-		if x.(uint8) < y.(uint8) {
-			res = -1
-		} else if x.(uint8) > y.(uint8) {
-			res = 1
-		}
-	case uint16:
-		if x.(uint16) < y.(uint16) {
-			res = -1
-		} else if x.(uint16) > y.(uint16) {
-			res = 1
-		}
-	case uint32:
-		if x.(uint32) < y.(uint32) {
-			res = -1
-		} else if x.(uint32) > y.(uint32) {
-			res = 1
-		}
-	case uint64:
-		if x.(uint64) < y.(uint64) {
-			res = -1
-		} else if x.(uint64) > y.(uint64) {
-			res = 1
-		}
-	}
-
-	return res
+func NewAggregator(opts ...Option) *Aggregator {
+	return &Aggregator{newCore[interface{}, interface{}, *entry, Aggregate](opts, newEntry, anyCounterDelta)}
 }
 
-func (a *Aggregator) convert(value interface{}) (interface{}, error) {
+// convert widens value to a float64, int64, uint64 or Value.
+func convert(value interface{}) (interface{}, error) {
 	var err error
 	var f interface{}
 
 	switch value.(type) {
+	case Value:
+		f = value
+	case complex64:
+		f = complexValue(value.(complex64))
+	case complex128:
+		f = complexValue(value.(complex128))
+	case *big.Int:
+		f = (*bigIntValue)(new(big.Int).Set(value.(*big.Int)))
 	case float32:
 		f = float64(value.(float32))
 	case float64:
@@ -164,153 +88,126 @@ func (a *Aggregator) convert(value interface{}) (interface{}, error) {
 		f = uint64(value.(uint32))
 	case uint64:
 		f = uint64(value.(uint64))
-	default:
-		err = syscall.ENOTSUP
+	default: // Named numeric types (e.g., time.Duration)
+		switch v := reflect.ValueOf(value); v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f = v.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = v.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = v.Uint()
+		default:
+			err = ErrUnsupportedType
+		}
 	}
 
 	return f, err
 }
 
-func (a *Aggregator) Delete(key interface{}) error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
+func (a *Aggregator) GetAverage(key interface{}) (interface{}, error) {
+	var avg interface{}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 
-	_, err := a.findRecord(key)
+	rec, err := a.findRecord(key)
 	if err == nil {
-		delete(a.db, key)
+		avg = rec.anyAverage()
 	}
 
-	return err
-}
-
-func (a *Aggregator) findRecord(key interface{}) (*record, error) {
-	var err error
-
-	rec, ok := a.db[key]
-	if !ok {
-		err = syscall.ENOENT
-	}
-
-	return rec, err
+	return avg, err
 }
 
-func (a *Aggregator) GetAverage(key interface{}) (interface{}, error) {
-	var avg interface{}
+// GetInstantRate returns the value of the last insert of key scaled to the
+// duration dur over the interval since the insert before it. It returns zero
+// if a single value has been inserted.
+func (a *Aggregator) GetInstantRate(key interface{}, dur time.Duration) (interface{}, error) {
+	var rate interface{}
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		if rec.count > 0 {
-			switch rec.value0.(type) {
-			case float32, float64:
-				return rec.sum.(float64) / float64(rec.count), err
-			case int, int8, int16, int32, int64:
-				return rec.sum.(int64) / rec.count, err
-			case uint, uint8, uint16, uint32, uint64:
-				return rec.sum.(uint64) / uint64(rec.count), err
-			default:
-				err = syscall.ENOTSUP
-			}
-		} else {
-			avg = rec.sum
-		}
+		rate, err = rec.anyInstantRate(dur)
 	}
 
-	return avg, err
+	return rate, err
 }
 
-func (a *Aggregator) GetCount(key interface{}) (int64, error) {
-	var cnt int64 = -1
+func (a *Aggregator) GetMaximum(key interface{}) (interface{}, error) {
+	var max interface{}
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		cnt = rec.count
+		max = rec.original(rec.anyMax())
 	}
 
-	return cnt, err
+	return max, err
 }
 
-func (a *Aggregator) GetDuration(key interface{}) (time.Duration, error) {
-	var dur time.Duration
+func (a *Aggregator) GetMinimum(key interface{}) (interface{}, error) {
+	var min interface{}
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		dur = rec.timeN.Sub(rec.time0)
+		min = rec.original(rec.anyMin())
 	}
 
-	return dur, err
+	return min, err
 }
 
-func (a *Aggregator) GetMaximum(key interface{}) (interface{}, error) {
-	var max interface{}
+// GetPreviousWindow returns the last completed window of key. It returns
+// ErrNotSupported unless the aggregator was created with a window option.
+func (a *Aggregator) GetPreviousWindow(key interface{}) (Aggregate, error) {
+	return a.getWindow(key, true)
+}
+
+func (a *Aggregator) GetRate(key interface{}, dur time.Duration) (interface{}, error) {
+	var rate interface{}
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		max = rec.max
+		rate, err = rec.anyRate(dur)
 	}
 
-	return max, err
+	return rate, err
 }
 
-func (a *Aggregator) GetMinimum(key interface{}) (interface{}, error) {
-	var min interface{}
+// GetRateBetween returns the sum of key scaled to the duration dur over the
+// interval from start to end, such as the interval of a report. The sum is
+// not filtered by time, so it returns ErrInvalid unless every value of key
+// was inserted between start and end.
+func (a *Aggregator) GetRateBetween(key interface{}, start, end time.Time, dur time.Duration) (interface{}, error) {
+	var rate interface{}
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		min = rec.min
+		rate, err = rec.anyRateBetween(start, end, dur)
 	}
 
-	return min, err
+	return rate, err
 }
 
-func (a *Aggregator) GetRate(key interface{}, dur time.Duration) (interface{}, error) {
+// GetRateSinceFirst returns the sum of key scaled to the duration dur over
+// the interval from the first value inserted to now, or to the last value
+// inserted if it is later, so the rate of a key decays while no values are
+// inserted.
+func (a *Aggregator) GetRateSinceFirst(key interface{}, dur time.Duration) (interface{}, error) {
 	var rate interface{}
+	now := a.opts.clock.Now()
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		elapsedNsec := rec.timeN.Sub(rec.time0).Nanoseconds()
-		switch rec.value0.(type) {
-		case float32, float64:
-			if elapsedNsec != 0 {
-				// Protect against overflow on duration multiplier?
-				rate = rec.sum.(float64) * float64(dur.Nanoseconds()) / float64(elapsedNsec)
-			} else {
-				rate = float64(0)
-			}
-		case int, int8, int16, int32, int64:
-			if elapsedNsec != 0 {
-				// Protect against overflow on duration multiplier?
-				rate = rec.sum.(int64) * dur.Nanoseconds() / elapsedNsec
-			} else {
-				rate = int64(0)
-			}
-		case uint, uint8, uint16, uint32, uint64:
-			if dur >= 0 {
-				if elapsedNsec > 0 {
-					// Protect against overflow on duration multiplier?
-					rate = rec.sum.(uint64) * uint64(dur.Nanoseconds()) / uint64(elapsedNsec)
-				} else if elapsedNsec == 0 {
-					rate = uint64(0)
-				} else {
-					err = syscall.EINVAL
-				}
-			} else {
-				err = syscall.EINVAL
-			}
-		default:
-			err = syscall.ENOTSUP
-		}
+		rate, err = rec.anyRateBetween(rec.head().time0, later(now, rec.head().timeN), dur)
 	}
 
 	return rate, err
@@ -323,53 +220,264 @@ func (a *Aggregator) GetSum(key interface{}) (interface{}, error) {
 
 	rec, err := a.findRecord(key)
 	if err == nil {
-		sum = rec.sum
+		sum = rec.anySum()
 	}
 
 	return sum, err
 }
 
-// Protect against overflow?
-// Allow custom add/product functions for structs (e.g., complex numbers)?
-func (a *Aggregator) Insert(key interface{}, value interface{}) error {
+// GetWindow returns the window of key that ends now. It returns
+// ErrNotSupported unless the aggregator was created with a window option.
+func (a *Aggregator) GetWindow(key interface{}) (Aggregate, error) {
+	return a.getWindow(key, false)
+}
+
+func (a *Aggregator) getWindow(key interface{}, previous bool) (Aggregate, error) {
+	var agg Aggregate
+	now := a.opts.clock.Now()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		if agg, err = rec.anyWindow(now, previous); err == nil {
+			agg.Max = rec.original(agg.Max)
+			agg.Min = rec.original(agg.Min)
+		}
+	}
+
+	return agg, err
+}
+
+// InsertBatch inserts every sample under a single lock with the same
+// timestamp. Samples that cannot be inserted are skipped and the first error
+// is returned.
+func (a *Aggregator) InsertBatch(samples []Sample) error {
+	return a.insertBatch(len(samples), func(i int) (interface{}, interface{}, int64) {
+		return samples[i].Key, samples[i].Value, samples[i].Weight
+	})
+}
+
+// Export returns the state of every key read under a single lock. The states
+// can be encoded and merged into another aggregator with MergeState.
+func (a *Aggregator) Export() map[interface{}]AnyState {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	states := make(map[interface{}]AnyState, len(a.db))
+	for key, e := range a.db {
+		states[key] = e.state()
+	}
+	return states
+}
+
+// Merge merges every key of other into the aggregator. Keys that exist in
+// both aggregators with different value types are skipped and the first error
+// is returned.
+func (a *Aggregator) Merge(other *Aggregator) error {
+	if other == a {
+		return ErrInvalid
+	}
+
+	var err error
+	entries := make(map[interface{}]*entry)
+
+	other.mu.RLock()
+	for key, e := range other.db {
+		if rec, e2 := e.anyCopy(a.opts); e2 == nil {
+			entries[key] = &entry{anyRecord: rec, value0: e.value0}
+		} else if err == nil {
+			err = e2
+		}
+	}
+	other.mu.RUnlock()
+
+	if e := a.mergeEntries(entries); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// MergeState merges the state s of key, exported from another aggregator,
+// into the aggregator. It returns ErrMalformedState if s is malformed and
+// a *TypeMismatchError if key has values of another type.
+func (a *Aggregator) MergeState(key interface{}, s AnyState) error {
+	e, err := newEntryFromState(s, a.opts)
+	if err != nil {
+		return err
+	}
+
+	return a.mergeEntries(map[interface{}]*entry{key: e})
+}
+
+// mergeEntries merges entries that are not shared with another aggregator
+// into the aggregator.
+func (a *Aggregator) mergeEntries(entries map[interface{}]*entry) error {
 	var err error
-	now := time.Now()
 
 	a.mu.Lock()
-	defer a.mu.Unlock()
-	if entry, ok := a.db[key]; ok {
-		if reflect.TypeOf(value) == reflect.TypeOf(entry.value0) {
-			var newValue interface{}
-			if newValue, err = a.convert(value); err == nil {
-				entry.count += 1
-				entry.sum = a.add(entry.sum, newValue)
-				entry.timeN = now
-
-				if a.compare(value, entry.min) == -1 {
-					entry.min = value
-				}
-
-				if a.compare(value, entry.max) == 1 {
-					entry.max = value
-				}
-			}
+	for key, e := range entries {
+		var e2 error
+		if rec, ok := a.db[key]; ok {
+			e2 = rec.merge(e, a.opts.overflow)
 		} else {
-			err = syscall.EINVAL
+			a.db[key] = e
+		}
+
+		if e2 == nil {
+			a.evictor.touch(key)
+		} else if err == nil {
+			err = e2
+		}
+	}
+	evicted := a.evict(false)
+	a.mu.Unlock()
+
+	a.evictor.notify(evicted)
+	return err
+}
+
+// RollUp groups the keys that are Labels by the labels with the given names
+// and returns the combined aggregate functions of each group. Keys that are
+// not Labels are ignored and grouping by no names combines every Labels key.
+// Keys whose values have a different type than the rest of their group are
+// skipped and the first error is returned.
+func (a *Aggregator) RollUp(names ...string) (map[Labels]Aggregate, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var err error
+	groups := make(map[Labels]*entry)
+	for key, e := range a.db {
+		labels, ok := key.(Labels)
+		if !ok {
+			continue
 		}
-	} else {
-		var newValue interface{}
-		if newValue, err = a.convert(value); err == nil {
-			a.db[key] = &record{
-				count:  1,
-				max:    value,
-				min:    value,
-				sum:    newValue,
-				time0:  now,
-				timeN:  now,
-				value0: value,
+
+		var e2 error
+		group := labels.Keep(names...)
+		if g, ok := groups[group]; ok {
+			e2 = g.merge(e, a.opts.overflow)
+		} else {
+			var rec anyRecord
+			if rec, e2 = e.anyCopy(a.opts); e2 == nil {
+				groups[group] = &entry{anyRecord: rec, value0: e.value0}
 			}
 		}
+
+		if e2 != nil && err == nil {
+			err = e2
+		}
+	}
+
+	rollup := make(map[Labels]Aggregate, len(groups))
+	for group, g := range groups {
+		rollup[group] = g.aggregate()
+	}
+
+	return rollup, err
+}
+
+// Rows returns the row of every key for a Formatter, read under a single lock.
+func (a *Aggregator) Rows() []Row {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rows := make([]Row, 0, len(a.db))
+	for key, e := range a.db {
+		rows = append(rows, NewRow(key, e.aggregate(), e.head().timeN.Sub(e.head().time0)))
+	}
+	return rows
+}
+
+// TopN returns up to n keys with the greatest value(agg) in decreasing order.
+// For example, value may return the sum of a key to find the keys with the
+// greatest sums. Numbers are compared by value and values of custom types by
+// Less.
+func (a *Aggregator) TopN(n int, value func(agg Aggregate) interface{}) []interface{} {
+	return topN(a.Snapshot(), n, func(x, y Aggregate) bool {
+		return a.less(value(x), value(y))
+	})
+}
+
+// merge combines other with the entry. It returns a TypeMismatchError if the
+// entries have values of different types.
+func (e *entry) merge(other *entry, policy OverflowPolicy) error {
+	if reflect.TypeOf(e.value0) != reflect.TypeOf(other.value0) {
+		return &TypeMismatchError{Expected: reflect.TypeOf(e.value0), Received: reflect.TypeOf(other.value0)}
+	}
+	return e.anyMerge(other.anyRecord, policy)
+}
+
+// newEntry creates an entry of weight values whose sum is value.
+func newEntry(value interface{}, weight int64, now time.Time, opts *options) (*entry, error) {
+	v, err := convert(value)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{value0: value}
+	switch v := v.(type) {
+	case float64:
+		e.anyRecord = newRecord(v, weight, now, opts)
+	case int64:
+		e.anyRecord = newRecord(v, weight, now, opts)
+	case uint64:
+		e.anyRecord = newRecord(v, weight, now, opts)
+	case Value:
+		e.anyRecord = newCustomRecord(v, weight, reflect.TypeOf(value), now)
+	}
+
+	return e, nil
+}
+
+// insert adds value, the sum of weight observations, to the entry. It returns
+// a TypeMismatchError if value has a different type than value0.
+func (e *entry) insert(value interface{}, weight int64, now time.Time, policy OverflowPolicy) error {
+	if reflect.TypeOf(value) != reflect.TypeOf(e.value0) {
+		return &TypeMismatchError{Expected: reflect.TypeOf(e.value0), Received: reflect.TypeOf(value)}
+	}
+
+	v, err := convert(value)
+	if err == nil {
+		err = e.anyInsert(v, weight, now, policy)
 	}
 
 	return err
 }
+
+// original converts a widened value back to the type of value0.
+func (e *entry) original(value interface{}) interface{} {
+	return reflect.ValueOf(value).Convert(reflect.TypeOf(e.value0)).Interface()
+}
+
+// aggregate returns the aggregate functions of the entry with the minimum and
+// maximum converted to the type of value0.
+func (e *entry) aggregate() Aggregate {
+	agg := e.anyAggregate()
+	agg.Max = e.original(agg.Max)
+	agg.Min = e.original(agg.Min)
+	return agg
+}
+
+// The methods of coreRecord are forwarded explicitly rather than promoted from
+// anyRecord, since some toolchains drop the methods of records that are only
+// called through promoted methods in generic code.
+
+func (e *entry) anyVariance() (float64, error) {
+	return e.anyRecord.anyVariance()
+}
+
+func (e *entry) getHistogram() (Histogram, error) {
+	return e.anyRecord.getHistogram()
+}
+
+func (e *entry) head() *header {
+	return e.anyRecord.head()
+}
+
+func (e *entry) percentile(q float64) (float64, error) {
+	return e.anyRecord.percentile(q)
+}
@@ -1,7 +1,7 @@
 package aggregator
 
 import (
-	"syscall"
+	"math"
 	"testing"
 	"time"
 
@@ -15,7 +15,7 @@ var unityTypes = []interface{}{
 
 func TestAggregator_Delete_InvalidKey(t *testing.T) {
 	a := NewAggregator()
-	assert.Equal(t, syscall.ENOENT, a.Delete("invalid"))
+	assert.ErrorIs(t, a.Delete("invalid"), ErrNotFound)
 }
 
 func TestAggregator_Delete_ValidKey(t *testing.T) {
@@ -30,11 +30,28 @@ func TestAggregator_Delete_ValidKey(t *testing.T) {
 	}
 }
 
+func TestAggregator_Get_InvalidKey(t *testing.T) {
+	a := NewAggregator()
+	agg, err := a.Get("invalid")
+	assert.Equal(t, Aggregate{}, agg)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAggregator_Get_ValidKey(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", int8(-2)))
+	assert.Nil(t, a.Insert("key", int8(6)))
+
+	agg, err := a.Get("key")
+	assert.Equal(t, Aggregate{Avg: int64(2), Cnt: int64(2), Max: int8(6), Min: int8(-2), Sum: int64(4)}, agg)
+	assert.Nil(t, err)
+}
+
 func TestAggregator_GetAverage_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	avg, err := a.GetAverage("invalid")
 	assert.Nil(t, avg)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetAverage_ValidKey(t *testing.T) {
@@ -45,7 +62,7 @@ func TestAggregator_GetAverage_ValidKey(t *testing.T) {
 		assert.Nil(t, a.Insert(i, typ))
 		assert.Nil(t, a.Insert(i, typ))
 
-		a.db[i].count -= 1 // Mock the insert count
+		a.db[i].head().count -= 1 // Mock the insert count
 	}
 
 	for i, typ := range unityTypes {
@@ -72,7 +89,7 @@ func TestAggregator_GetCount_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	cnt, err := a.GetCount("invalid")
 	assert.Equal(t, int64(-1), cnt)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetCount_ValidKey(t *testing.T) {
@@ -94,7 +111,7 @@ func TestAggregator_GetDuration_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	dur, err := a.GetDuration("invalid")
 	assert.Equal(t, time.Duration(0), dur)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetDuration_MultiInsert(t *testing.T) {
@@ -124,11 +141,45 @@ func TestAggregator_GetDuration_SingleInsert(t *testing.T) {
 	}
 }
 
+func TestAggregator_GetEWMA(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", 1))
+
+	_, err := a.GetEWMA("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetEWMARate("key", time.Second)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	a = NewAggregator(WithEWMA(time.Hour))
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+
+		avg, err := a.GetEWMA(i)
+		assert.Equal(t, float64(1), avg)
+		assert.Nil(t, err)
+
+		rate, err := a.GetEWMARate(i, time.Hour)
+		assert.InDelta(t, math.Ln2, rate, 1e-6)
+		assert.Nil(t, err)
+	}
+}
+
+func TestAggregator_GetHistogram(t *testing.T) {
+	a := NewAggregator(WithHistogram(LinearBuckets(0, 1, 2)))
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+
+		h, err := a.GetHistogram(i)
+		assert.Equal(t, Histogram{Bounds: []float64{0, 1}, Counts: []uint64{0, 1, 0}}, h)
+		assert.Nil(t, err)
+	}
+}
+
 func TestAggregator_GetMaximum_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	max, err := a.GetMaximum("invalid")
 	assert.Nil(t, max)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetMaximum_ValidKey(t *testing.T) {
@@ -209,7 +260,7 @@ func TestAggregator_GetMinimum_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	min, err := a.GetMinimum("invalid")
 	assert.Nil(t, min)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetMinimum_ValidKey(t *testing.T) {
@@ -286,13 +337,35 @@ func TestAggregator_GetMinimum_ValidKey(t *testing.T) {
 	}
 }
 
+func TestAggregator_GetPercentile_InvalidKey(t *testing.T) {
+	a := NewAggregator()
+	p, err := a.GetPercentile("invalid", 0.5)
+	assert.Equal(t, float64(0), p)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAggregator_GetPercentile_ValidKey(t *testing.T) {
+	a := NewAggregator()
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+
+		p, err := a.GetPercentile(i, 0.5)
+		assert.Equal(t, float64(1), p)
+		assert.Nil(t, err)
+
+		p, err = a.GetPercentile(i, -0.5)
+		assert.Equal(t, float64(0), p)
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+}
+
 func TestAggregator_GetRate_DurationNegative(t *testing.T) {
 	for _, typ := range unityTypes {
 		a := NewAggregator()
 		assert.Nil(t, a.Insert(typ, typ))
 		assert.Nil(t, a.Insert(typ, typ))
 
-		a.db[typ].timeN = a.db[typ].time0.Add(time.Millisecond * 500) // Mock the elapsed time
+		a.db[typ].head().timeN = a.db[typ].head().time0.Add(time.Millisecond * 500) // Mock the elapsed time
 
 		rate, err := a.GetRate(typ, -time.Second)
 		switch typ.(type) {
@@ -304,7 +377,7 @@ func TestAggregator_GetRate_DurationNegative(t *testing.T) {
 			assert.Equal(t, nil, err)
 		case uint, uint8, uint16, uint32, uint64:
 			assert.Equal(t, nil, rate)
-			assert.Equal(t, syscall.EINVAL, err)
+			assert.ErrorIs(t, err, ErrInvalid)
 		default:
 			assert.Fail(t, "unsupported type")
 		}
@@ -317,7 +390,7 @@ func TestAggregator_GetRate_DurationPositive(t *testing.T) {
 		assert.Nil(t, a.Insert(typ, typ))
 		assert.Nil(t, a.Insert(typ, typ))
 
-		a.db[typ].timeN = a.db[typ].time0.Add(time.Millisecond * 500) // Mock the elapsed time
+		a.db[typ].head().timeN = a.db[typ].head().time0.Add(time.Millisecond * 500) // Mock the elapsed time
 
 		rate, err := a.GetRate(typ, time.Second)
 		switch typ.(type) {
@@ -342,7 +415,7 @@ func TestAggregator_GetRate_DurationZero(t *testing.T) {
 		assert.Nil(t, a.Insert(typ, typ))
 		assert.Nil(t, a.Insert(typ, typ))
 
-		a.db[typ].timeN = a.db[typ].time0.Add(time.Millisecond * 500) // Mock the elapsed time
+		a.db[typ].head().timeN = a.db[typ].head().time0.Add(time.Millisecond * 500) // Mock the elapsed time
 
 		rate, err := a.GetRate(typ, 0)
 		switch typ.(type) {
@@ -365,7 +438,7 @@ func TestAggregator_GetRate_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	rate, err := a.GetRate("invalid", time.Second)
 	assert.Equal(t, nil, rate)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetRate_SingleInsert(t *testing.T) {
@@ -389,11 +462,46 @@ func TestAggregator_GetRate_SingleInsert(t *testing.T) {
 	}
 }
 
+func TestAggregator_GetRate_Variants(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	clock := &mockClock{now: t0}
+	a := NewAggregator(WithClock(clock))
+
+	_, err := a.GetRateSinceFirst("key", time.Second)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, a.Insert("key", int32(100)))
+	assert.Nil(t, a.InsertAt("key", int32(-20), t0.Add(2*time.Second)))
+	clock.now = t0.Add(4 * time.Second)
+
+	rate, err := a.GetInstantRate("key", time.Second)
+	assert.Equal(t, int64(-10), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetRateSinceFirst("key", time.Second)
+	assert.Equal(t, int64(20), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetRateBetween("key", t0, t0.Add(8*time.Second), time.Second)
+	assert.Equal(t, int64(10), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetRateBetween("key", t0, t0.Add(-time.Second), time.Second)
+	assert.Nil(t, rate)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	assert.Nil(t, a.Insert("complex", complex(1, 0)))
+	_, err = a.GetInstantRate("complex", time.Second)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetRateSinceFirst("complex", time.Second)
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
 func TestAggregator_GetSum_InvalidKey(t *testing.T) {
 	a := NewAggregator()
 	sum, err := a.GetSum("invalid")
 	assert.Equal(t, nil, sum)
-	assert.Equal(t, syscall.ENOENT, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestAggregator_GetSum_ValidKey(t *testing.T) {
@@ -439,6 +547,55 @@ func TestAggregator_GetSum_ValidKey(t *testing.T) {
 	}
 }
 
+func TestAggregator_GetVariance(t *testing.T) {
+	a := NewAggregator()
+	_, err := a.GetVariance("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+
+		v, err := a.GetVariance(i)
+		assert.Equal(t, float64(0), v)
+		assert.Nil(t, err)
+	}
+
+	for _, value := range []int{2, 4, 4, 4, 5, 5, 7, 9} {
+		assert.Nil(t, a.Insert("key", value))
+	}
+
+	sd, err := a.GetStdDev("key")
+	assert.Equal(t, float64(2), sd)
+	assert.Nil(t, err)
+}
+
+func TestAggregator_GetWindow(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", 1))
+
+	_, err := a.GetWindow("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	a = NewAggregator(WithSlidingWindow(time.Hour, 60))
+	_, err = a.GetWindow("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+		assert.Nil(t, a.Insert(i, typ))
+
+		w, err := a.GetWindow(i)
+		assert.Equal(t, int64(2), w.Cnt)
+		assert.Equal(t, typ, w.Max)
+		assert.Equal(t, typ, w.Min)
+		assert.Nil(t, err)
+
+		w, err = a.GetPreviousWindow(i)
+		assert.Equal(t, int64(0), w.Cnt)
+		assert.Nil(t, err)
+	}
+}
+
 func TestAggregator_Insert_InconsistentType(t *testing.T) {
 	a := NewAggregator()
 	for i, typ := range unityTypes {
@@ -447,13 +604,112 @@ func TestAggregator_Insert_InconsistentType(t *testing.T) {
 
 	for i, typ := range unityTypes {
 		j := (i + 1) % len(unityTypes)
-		assert.Equal(t, syscall.EINVAL, a.Insert(j, typ))
+		assert.ErrorIs(t, a.Insert(j, typ), ErrInvalid)
+	}
+}
+
+func TestAggregator_Insert_NamedType(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", time.Second))
+	assert.Nil(t, a.Insert("key", time.Minute))
+	assert.ErrorIs(t, a.Insert("key", int64(1)), ErrInvalid)
+
+	agg, err := a.Get("key")
+	assert.Equal(t, Aggregate{
+		Avg: int64(30500 * time.Millisecond),
+		Cnt: int64(2),
+		Max: time.Minute,
+		Min: time.Second,
+		Sum: int64(61 * time.Second),
+	}, agg)
+	assert.Nil(t, err)
+}
+
+func TestAggregator_Insert_Overflow(t *testing.T) {
+	a := NewAggregator(WithOverflowPolicy(OverflowError))
+	assert.Nil(t, a.Insert("key", uint8(255)))
+	assert.Nil(t, a.Insert("key", uint8(255)))
+
+	sum, err := a.GetSum("key")
+	assert.Equal(t, uint64(510), sum)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.Insert("max", int64(math.MaxInt64)))
+	assert.ErrorIs(t, a.Insert("max", int64(1)), ErrOverflow)
+
+	cnt, err := a.GetCount("max")
+	assert.Equal(t, int64(1), cnt)
+	assert.Nil(t, err)
+
+	a = NewAggregator()
+	assert.Nil(t, a.Insert("max", int64(math.MaxInt64)))
+	assert.Nil(t, a.Insert("max", int64(1)))
+
+	sum, err = a.GetSum("max")
+	assert.Equal(t, int64(math.MaxInt64), sum)
+	assert.Nil(t, err)
+}
+
+func TestAggregator_InsertAt(t *testing.T) {
+	clock := &mockClock{now: time.Unix(1700000000, 0)}
+	a := NewAggregator(WithClock(clock))
+
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+		assert.Nil(t, a.InsertAt(i, typ, clock.now.Add(-time.Second)))
+		assert.ErrorIs(t, a.InsertAt(i, "value", clock.now), ErrInvalid)
+
+		dur, err := a.GetDuration(i)
+		assert.Equal(t, time.Second, dur)
+		assert.Nil(t, err)
+
+		cnt, err := a.GetCount(i)
+		assert.Equal(t, int64(2), cnt)
+		assert.Nil(t, err)
 	}
 }
 
+func TestAggregator_InsertBatch(t *testing.T) {
+	a := NewAggregator()
+
+	var mismatch *TypeMismatchError
+	assert.ErrorAs(t, a.InsertBatch([]Sample{
+		{Key: "a", Value: int32(1)},
+		{Key: "a", Value: int64(2)},
+		{Key: "b", Value: 1.5, Weight: 3},
+		{Key: "a", Value: int32(3)},
+	}), &mismatch)
+
+	agg, err := a.Get("a")
+	assert.Equal(t, Aggregate{Avg: int64(2), Cnt: int64(2), Max: int32(3), Min: int32(1), Sum: int64(4)}, agg)
+	assert.Nil(t, err)
+
+	agg, err = a.Get("b")
+	assert.Equal(t, Aggregate{Avg: 0.5, Cnt: int64(3), Max: 0.5, Min: 0.5, Sum: 1.5}, agg)
+	assert.Nil(t, err)
+}
+
+func TestAggregator_InsertWeighted(t *testing.T) {
+	a := NewAggregator()
+
+	assert.Nil(t, a.InsertWeighted("pkt", int32(1000), 10))
+	assert.Nil(t, a.Insert("pkt", int32(400)))
+	assert.ErrorIs(t, a.InsertWeighted("pkt", int32(1), -1), ErrInvalid)
+
+	agg, err := a.Get("pkt")
+	assert.Equal(t, Aggregate{Avg: int64(127), Cnt: int64(11), Max: int32(400), Min: int32(100), Sum: int64(1400)}, agg)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.InsertWeighted("c", complex(4, 2), 2))
+	agg, err = a.Get("c")
+	assert.Equal(t, Aggregate{Avg: complex(2, 1), Cnt: int64(2), Max: complex(2, 1), Min: complex(2, 1), Sum: complex(4, 2)}, agg)
+	assert.Nil(t, err)
+}
+
 func TestAggregator_Insert_InvalidType(t *testing.T) {
 	a := NewAggregator()
-	assert.Equal(t, syscall.ENOTSUP, a.Insert("key", time.Duration(0)))
+	assert.ErrorIs(t, a.Insert("key", "value"), ErrUnsupportedType)
+	assert.ErrorIs(t, a.Insert("key", struct{}{}), ErrUnsupportedType)
 }
 
 func TestAggregator_Insert_ValidType(t *testing.T) {
@@ -467,6 +723,59 @@ func TestAggregator_Insert_ValidType(t *testing.T) {
 	}
 }
 
+func TestAggregator_Snapshot(t *testing.T) {
+	a := NewAggregator()
+	assert.Equal(t, map[interface{}]Aggregate{}, a.Snapshot())
+
+	for i, typ := range unityTypes {
+		assert.Nil(t, a.Insert(i, typ))
+	}
+
+	snap := a.Snapshot()
+	assert.Equal(t, len(unityTypes), len(snap))
+	for i, typ := range unityTypes {
+		assert.Equal(t, int64(1), snap[i].Cnt)
+		assert.Equal(t, typ, snap[i].Max)
+		assert.Equal(t, typ, snap[i].Min)
+	}
+	assert.Equal(t, len(unityTypes), len(a.db))
+}
+
+func TestAggregator_SnapshotAndReset(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", uint16(3)))
+
+	snap := a.SnapshotAndReset()
+	assert.Equal(t, map[interface{}]Aggregate{
+		"key": {Avg: uint64(3), Cnt: int64(1), Max: uint16(3), Min: uint16(3), Sum: uint64(3)},
+	}, snap)
+	assert.Equal(t, 0, len(a.db))
+	assert.Equal(t, 0, len(a.SnapshotAndReset()))
+}
+
+func TestAggregator_Merge(t *testing.T) {
+	a1, a2 := NewAggregator(), NewAggregator()
+	assert.ErrorIs(t, a1.Merge(a1), ErrInvalid)
+
+	assert.Nil(t, a1.Insert("int", uint16(3)))
+	assert.Nil(t, a2.Insert("int", uint16(5)))
+	assert.Nil(t, a2.Insert("float", 1.5))
+	assert.Nil(t, a1.Insert("custom", byteCounter{bytes: 2, packets: 1}))
+	assert.Nil(t, a2.Insert("custom", byteCounter{bytes: 4, packets: 1}))
+	assert.Nil(t, a1.Insert("mixed", int8(1)))
+	assert.Nil(t, a2.Insert("mixed", 1.0))
+
+	assert.ErrorIs(t, a1.Merge(a2), ErrInvalid)
+	assert.Equal(t, Aggregate{Avg: uint64(4), Cnt: int64(2), Max: uint16(5), Min: uint16(3), Sum: uint64(8)}, mustGet(t, a1, "int"))
+	assert.Equal(t, Aggregate{Avg: 1.5, Cnt: int64(1), Max: 1.5, Min: 1.5, Sum: 1.5}, mustGet(t, a1, "float"))
+	assert.Equal(t, Aggregate{Avg: byteCounter{bytes: 3, packets: 1}, Cnt: int64(2), Max: byteCounter{bytes: 4, packets: 1}, Min: byteCounter{bytes: 2, packets: 1}, Sum: byteCounter{bytes: 6, packets: 2}}, mustGet(t, a1, "custom"))
+	assert.Equal(t, int64(1), mustGet(t, a1, "mixed").Cnt)
+
+	// The merged keys are copies
+	assert.Nil(t, a2.Insert("float", 2.5))
+	assert.Equal(t, int64(1), mustGet(t, a1, "float").Cnt)
+}
+
 func TestAggregator_NewAggregator(t *testing.T) {
 	a := NewAggregator()
 
@@ -475,3 +784,9 @@ func TestAggregator_NewAggregator(t *testing.T) {
 	assert.Equal(t, 0, len(a.db))
 	assert.NotNil(t, a.mu)
 }
+
+func mustGet(t *testing.T, a *Aggregator, key interface{}) Aggregate {
+	agg, err := a.Get(key)
+	assert.Nil(t, err)
+	return agg
+}
@@ -0,0 +1,218 @@
+package aggregator
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Integer is the set of value types that can be aggregated by an
+// AtomicAggregator.
+type Integer interface {
+	~int64 | ~uint64
+}
+
+// AtomicAggregator aggregates the int64 or uint64 values of pre-registered
+// keys without locks. Register returns a Handle whose Insert updates the
+// count, sum, minimum, maximum and duration of its key with atomic operations
+// and allocates nothing, which suits hot counters that are known in advance.
+// Only the WithClock and WithOverflowPolicy options are supported.
+type AtomicAggregator[K comparable, V Integer] struct {
+	handles map[K]*Handle[V]
+	mu      *sync.RWMutex
+	opts    *options
+}
+
+// Handle is a registered key of an AtomicAggregator. It is safe for
+// concurrent use. The fields of a key are updated independently, so an
+// aggregate read while values are inserted may include a value in some
+// fields but not in others.
+type Handle[V Integer] struct {
+	count atomic.Int64
+	max   atomic.Uint64
+	min   atomic.Uint64
+	opts  *options
+	sum   atomic.Uint64
+	time0 atomic.Int64
+	timeN atomic.Int64
+}
+
+// NewAtomicAggregator creates and returns a new AtomicAggregator instance.
+func NewAtomicAggregator[K comparable, V Integer](opts ...Option) *AtomicAggregator[K, V] {
+	o := newOptions(opts)
+	if o.counterBits > 0 || o.ewmaHalfLife > 0 || o.histogram != nil || o.maxKeys > 0 || o.onEvict != nil || o.ttl > 0 || o.windowSize > 0 {
+		panic("atomic aggregator supports only the clock and overflow options")
+	}
+
+	return &AtomicAggregator[K, V]{
+		handles: make(map[K]*Handle[V]),
+		mu:      &sync.RWMutex{},
+		opts:    o,
+	}
+}
+
+// Get returns the aggregate functions of key. It returns ErrNotFound if key
+// is not registered or no value has been inserted for it.
+func (a *AtomicAggregator[K, V]) Get(key K) (TypedAggregate[V], error) {
+	a.mu.RLock()
+	h, ok := a.handles[key]
+	a.mu.RUnlock()
+
+	if !ok || h.count.Load() == 0 {
+		return TypedAggregate[V]{}, ErrNotFound
+	}
+	return h.Aggregate(), nil
+}
+
+func (a *AtomicAggregator[K, V]) getClock() Clock {
+	return a.opts.clock
+}
+
+// Keys returns every registered key in unspecified order.
+func (a *AtomicAggregator[K, V]) Keys() []K {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	keys := make([]K, 0, len(a.handles))
+	for key := range a.handles {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Register returns the handle of key, registering key if it is new.
+func (a *AtomicAggregator[K, V]) Register(key K) *Handle[V] {
+	a.mu.RLock()
+	h, ok := a.handles[key]
+	a.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if h, ok = a.handles[key]; !ok {
+		h = &Handle[V]{opts: a.opts}
+		h.reset()
+		a.handles[key] = h
+	}
+	return h
+}
+
+// Snapshot returns the aggregate functions of every key into which a value
+// has been inserted.
+func (a *AtomicAggregator[K, V]) Snapshot() map[K]TypedAggregate[V] {
+	return a.snapshot(false)
+}
+
+// SnapshotAndReset returns the aggregate functions of every key into which a
+// value has been inserted and resets every key, which remains registered.
+// The fields of a value inserted during the reset may be split between the
+// snapshot and the next one.
+func (a *AtomicAggregator[K, V]) SnapshotAndReset() map[K]TypedAggregate[V] {
+	return a.snapshot(true)
+}
+
+func (a *AtomicAggregator[K, V]) snapshot(reset bool) map[K]TypedAggregate[V] {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	snap := make(map[K]TypedAggregate[V])
+	for key, h := range a.handles {
+		var agg TypedAggregate[V]
+		if reset {
+			agg = h.reset()
+		} else {
+			agg = h.Aggregate()
+		}
+
+		if agg.Cnt > 0 {
+			snap[key] = agg
+		}
+	}
+	return snap
+}
+
+// Aggregate returns the aggregate functions of the key. The aggregate of a
+// key without values is zero.
+func (h *Handle[V]) Aggregate() TypedAggregate[V] {
+	return h.aggregate(h.count.Load(), h.sum.Load(), h.min.Load(), h.max.Load())
+}
+
+func (h *Handle[V]) aggregate(count int64, sum, min, max uint64) TypedAggregate[V] {
+	if count == 0 {
+		return TypedAggregate[V]{}
+	}
+	return TypedAggregate[V]{Avg: V(sum) / V(count), Cnt: count, Max: V(max), Min: V(min), Sum: V(sum)}
+}
+
+// Duration returns the time between the first and the last value inserted
+// for the key.
+func (h *Handle[V]) Duration() time.Duration {
+	time0, timeN := h.time0.Load(), h.timeN.Load()
+	if time0 > timeN { // No value has been inserted
+		return 0
+	}
+	return time.Duration(timeN - time0)
+}
+
+// Insert adds value to the aggregate functions of the key. An integer sum
+// that overflows is handled according to the aggregator's OverflowPolicy.
+func (h *Handle[V]) Insert(value V) error {
+	for {
+		old := h.sum.Load()
+		sum, ok := addChecked(V(old), value)
+		if !ok && h.opts.overflow == OverflowError {
+			return ErrOverflow
+		}
+
+		if h.sum.CompareAndSwap(old, uint64(sum)) {
+			break
+		}
+	}
+
+	h.count.Add(1)
+	storeIf(&h.min, uint64(value), func(old uint64) bool { return value < V(old) })
+	storeIf(&h.max, uint64(value), func(old uint64) bool { return value > V(old) })
+
+	now := h.opts.clock.Now().UnixNano()
+	storeIf(&h.time0, now, func(old int64) bool { return now < old })
+	storeIf(&h.timeN, now, func(old int64) bool { return now > old })
+
+	return nil
+}
+
+// Rate returns the sum of the key per duration dur over the duration of the
+// key.
+func (h *Handle[V]) Rate(dur time.Duration) (V, error) {
+	return rateOf(V(h.sum.Load()), h.Duration(), dur)
+}
+
+// reset clears the key and returns its aggregate functions before the reset.
+func (h *Handle[V]) reset() TypedAggregate[V] {
+	lo, hi := limits[V]()
+
+	count := h.count.Swap(0)
+	sum := h.sum.Swap(0)
+	min := h.min.Swap(uint64(hi))
+	max := h.max.Swap(uint64(lo))
+	h.time0.Store(math.MaxInt64)
+	h.timeN.Store(math.MinInt64)
+
+	return h.aggregate(count, sum, min, max)
+}
+
+// storeIf stores value in addr unless replace returns false for the current
+// value.
+func storeIf[T any, A interface {
+	CompareAndSwap(old, new T) bool
+	Load() T
+}](addr A, value T, replace func(old T) bool) {
+	for old := addr.Load(); replace(old); old = addr.Load() {
+		if addr.CompareAndSwap(old, value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package aggregator
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicAggregator_Insert(t *testing.T) {
+	clock := &mockClock{now: time.Unix(1700000000, 0)}
+	a := NewAtomicAggregator[string, int64](WithClock(clock))
+
+	h := a.Register("key")
+	assert.Same(t, h, a.Register("key"))
+	_, err := a.Get("key")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = a.Get("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, h.Insert(-2))
+	clock.now = clock.now.Add(2 * time.Second)
+	assert.Nil(t, h.Insert(6))
+	assert.Nil(t, h.Insert(2))
+
+	agg, err := a.Get("key")
+	assert.Equal(t, TypedAggregate[int64]{Avg: 2, Cnt: 3, Max: 6, Min: -2, Sum: 6}, agg)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, h.Duration())
+
+	rate, err := h.Rate(time.Second)
+	assert.Equal(t, int64(3), rate)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key"}, a.Keys())
+}
+
+func TestAtomicAggregator_Insert_Overflow(t *testing.T) {
+	h := NewAtomicAggregator[string, uint64]().Register("saturate")
+	assert.Nil(t, h.Insert(math.MaxUint64))
+	assert.Nil(t, h.Insert(1))
+	assert.Equal(t, uint64(math.MaxUint64), h.Aggregate().Sum)
+
+	h = NewAtomicAggregator[string, uint64](WithOverflowPolicy(OverflowError)).Register("error")
+	assert.Nil(t, h.Insert(math.MaxUint64))
+	assert.ErrorIs(t, h.Insert(1), ErrOverflow)
+	assert.Equal(t, TypedAggregate[uint64]{Avg: math.MaxUint64, Cnt: 1, Max: math.MaxUint64, Min: math.MaxUint64, Sum: math.MaxUint64}, h.Aggregate())
+}
+
+func TestAtomicAggregator_Insert_Concurrent(t *testing.T) {
+	a := NewAtomicAggregator[string, uint64]()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := a.Register("conn")
+			for i := uint64(1); i <= 1000; i++ {
+				assert.Nil(t, h.Insert(i))
+			}
+		}()
+	}
+	wg.Wait()
+
+	agg, err := a.Get("conn")
+	assert.Equal(t, TypedAggregate[uint64]{Avg: 500, Cnt: 8000, Max: 1000, Min: 1, Sum: 8 * 500500}, agg)
+	assert.Nil(t, err)
+}
+
+func TestAtomicAggregator_Insert_NoAllocs(t *testing.T) {
+	h := NewAtomicAggregator[int, int64]().Register(1)
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() { h.Insert(1) }))
+}
+
+func TestAtomicAggregator_SnapshotAndReset(t *testing.T) {
+	a := NewAtomicAggregator[string, uint64]()
+	a.Register("idle")
+	h := a.Register("key")
+	assert.Nil(t, h.Insert(5))
+
+	assert.Equal(t, map[string]TypedAggregate[uint64]{"key": {Avg: 5, Cnt: 1, Max: 5, Min: 5, Sum: 5}}, a.Snapshot())
+	assert.Equal(t, map[string]TypedAggregate[uint64]{"key": {Avg: 5, Cnt: 1, Max: 5, Min: 5, Sum: 5}}, a.SnapshotAndReset())
+	assert.Equal(t, map[string]TypedAggregate[uint64]{}, a.Snapshot())
+	assert.Equal(t, time.Duration(0), h.Duration())
+
+	assert.Nil(t, h.Insert(3))
+	assert.Equal(t, map[string]TypedAggregate[uint64]{"key": {Avg: 3, Cnt: 1, Max: 3, Min: 3, Sum: 3}}, a.Snapshot())
+}
+
+func TestAtomicAggregator_NewAtomicAggregator(t *testing.T) {
+	assert.NotPanics(t, func() {
+		NewAtomicAggregator[string, int64](WithClock(systemClock{}), WithOverflowPolicy(OverflowError))
+	})
+	assert.Panics(t, func() { NewAtomicAggregator[string, int64](WithEWMA(time.Second)) })
+	assert.Panics(t, func() { NewAtomicAggregator[string, int64](WithTumblingWindow(time.Second)) })
+}
+
+func BenchmarkAtomicAggregator_Insert(b *testing.B) {
+	a := NewAtomicAggregator[int, int64]()
+	handles := make([]*Handle[int64], 1024)
+	for i := range handles {
+		handles[i] = a.Register(i)
+	}
+
+	benchmarkInsert(b, func(key int, value int64) error { return handles[key].Insert(value) })
+}
@@ -0,0 +1,417 @@
+package aggregator
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// core is the state shared by Aggregator and TypedAggregator: the record of
+// every key, the previous sample of every counter key, the order in which
+// keys are evicted and the lock that guards them. Values of type S are
+// inserted into records of type R, whose aggregate functions are returned as
+// an A.
+type core[K comparable, S any, R coreRecord[S, A], A any] struct {
+	counters map[K]counterSample[S]
+	create   func(value S, weight int64, now time.Time, opts *options) (R, error)
+	db       map[K]R
+	delta    func(last, next S, bits int) (S, error)
+	evictor  *evictor[K, A]
+	mu       *sync.RWMutex
+	opts     *options
+}
+
+// coreRecord is the record of a key of a core.
+type coreRecord[S, A any] interface {
+	head() *header
+	aggregate() A
+	anyVariance() (float64, error)
+	getHistogram() (Histogram, error)
+	insert(value S, weight int64, now time.Time, policy OverflowPolicy) error
+	percentile(q float64) (float64, error)
+}
+
+// newCore creates a core whose records are created by create. The increase
+// of a counter key is computed by delta, which returns an error if the
+// samples cannot be counted.
+func newCore[K comparable, S any, R coreRecord[S, A], A any](
+	opts []Option,
+	create func(value S, weight int64, now time.Time, opts *options) (R, error),
+	delta func(last, next S, bits int) (S, error),
+) *core[K, S, R, A] {
+	o := newOptions(opts)
+	return &core[K, S, R, A]{
+		counters: make(map[K]counterSample[S]),
+		create:   create,
+		db:       make(map[K]R),
+		delta:    delta,
+		evictor:  newEvictor[K, A](o),
+		mu:       &sync.RWMutex{},
+		opts:     o,
+	}
+}
+
+// count converts the counter sample value of key to the increase since the
+// previous sample of key, which is returned with the time of the previous
+// sample. It returns false for the first sample of a key, which only sets
+// the baseline of the key. The baseline is not updated until the increase
+// has been inserted.
+func (c *core[K, S, R, A]) count(key K, value S, t time.Time) (S, time.Time, bool, error) {
+	prev, ok := c.counters[key]
+	if !ok { // The first sample is counted against itself to check it
+		prev = counterSample[S]{time: t, value: value}
+	}
+
+	delta, err := c.delta(prev.value, value, c.opts.counterBits)
+	return delta, prev.time, ok, err
+}
+
+// Delete removes key, including its counter baseline. It returns ErrNotFound
+// if the aggregator has neither a record nor a baseline of key.
+func (c *core[K, S, R, A]) Delete(key K) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.findRecord(key)
+	if _, ok := c.counters[key]; ok || err == nil {
+		delete(c.counters, key)
+		delete(c.db, key)
+		c.evictor.remove(key)
+		err = nil
+	}
+
+	return err
+}
+
+func (c *core[K, S, R, A]) evict(all bool) []eviction[K, A] {
+	// Keys are evicted by their latest record or counter sample
+	timeN := func(key K) time.Time {
+		t := c.counters[key].time
+		if rec, ok := c.db[key]; ok {
+			t = later(t, rec.head().timeN)
+		}
+		return t
+	}
+
+	remove := func(key K) (A, bool) {
+		var agg A
+		rec, ok := c.db[key]
+		if ok {
+			agg = rec.aggregate()
+		}
+
+		delete(c.counters, key)
+		delete(c.db, key)
+		return agg, ok
+	}
+
+	return c.evictor.evict(c.opts.clock.Now(), all, timeN, remove)
+}
+
+// Expire evicts every key into which no value has been inserted for longer
+// than the TTL and returns the number of keys evicted.
+func (c *core[K, S, R, A]) Expire() int {
+	c.mu.Lock()
+	evicted := c.evict(true)
+	c.mu.Unlock()
+
+	c.evictor.notify(evicted)
+	return len(evicted)
+}
+
+// Filter returns the aggregate functions of the keys for which pred returns
+// true. The keys are read under a single lock and pred may use the
+// aggregator.
+func (c *core[K, S, R, A]) Filter(pred func(key K, agg A) bool) map[K]A {
+	return filter(c.Snapshot(), pred)
+}
+
+func (c *core[K, S, R, A]) findRecord(key K) (R, error) {
+	var err error
+
+	rec, ok := c.db[key]
+	if !ok {
+		err = ErrNotFound
+	}
+
+	return rec, err
+}
+
+// Get returns the aggregate functions of key read under a single lock.
+func (c *core[K, S, R, A]) Get(key K) (A, error) {
+	var agg A
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		agg = rec.aggregate()
+	}
+
+	return agg, err
+}
+
+func (c *core[K, S, R, A]) getClock() Clock {
+	return c.opts.clock
+}
+
+func (c *core[K, S, R, A]) GetCount(key K) (int64, error) {
+	var cnt int64 = -1
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		cnt = rec.head().count
+	}
+
+	return cnt, err
+}
+
+func (c *core[K, S, R, A]) GetDuration(key K) (time.Duration, error) {
+	var dur time.Duration
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		dur = rec.head().timeN.Sub(rec.head().time0)
+	}
+
+	return dur, err
+}
+
+// GetEWMA returns the exponentially weighted moving average of the values
+// inserted for key. It returns ErrNotSupported unless the aggregator was
+// created with WithEWMA.
+func (c *core[K, S, R, A]) GetEWMA(key K) (float64, error) {
+	var avg float64
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		avg, err = rec.head().getEWMA()
+	}
+
+	return avg, err
+}
+
+// GetEWMARate returns the exponentially weighted rate of key scaled to the
+// duration dur. It returns ErrNotSupported unless the aggregator was created
+// with WithEWMA.
+func (c *core[K, S, R, A]) GetEWMARate(key K, dur time.Duration) (float64, error) {
+	var rate float64
+	now := c.opts.clock.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		rate, err = rec.head().getEWMARate(now, dur)
+	}
+
+	return rate, err
+}
+
+// GetHistogram returns the histogram of the values inserted for key. It
+// returns ErrNotSupported unless the aggregator was created with WithHistogram.
+func (c *core[K, S, R, A]) GetHistogram(key K) (Histogram, error) {
+	var h Histogram
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		h, err = rec.getHistogram()
+	}
+
+	return h, err
+}
+
+// GetPercentile returns an estimate of the q-quantile of the values inserted
+// for key, where q is in [0, 1] (e.g., 0.99 for the 99th percentile). The
+// estimate has a relative error of at most 1% while the values of each sign
+// span less than 17 orders of magnitude. Beyond that, the values closest to
+// zero are estimated as the smallest value that still fits, and magnitudes
+// below 1e-9 are always estimated as zero.
+func (c *core[K, S, R, A]) GetPercentile(key K, q float64) (float64, error) {
+	var p float64
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		p, err = rec.percentile(q)
+	}
+
+	return p, err
+}
+
+// GetStdDev returns the population standard deviation of the values inserted
+// for key.
+func (c *core[K, S, R, A]) GetStdDev(key K) (float64, error) {
+	v, err := c.GetVariance(key)
+	return math.Sqrt(v), err
+}
+
+// GetVariance returns the population variance of the values inserted for key.
+func (c *core[K, S, R, A]) GetVariance(key K) (float64, error) {
+	var v float64
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, err := c.findRecord(key)
+	if err == nil {
+		v, err = rec.anyVariance()
+	}
+
+	return v, err
+}
+
+// Insert adds value to the aggregate functions of key. An integer sum that
+// overflows is handled according to the aggregator's OverflowPolicy.
+func (c *core[K, S, R, A]) Insert(key K, value S) error {
+	return c.InsertAt(key, value, c.opts.clock.Now())
+}
+
+// insert adds value, the sum of weight observations, to the aggregate
+// functions of key. The caller must hold the lock.
+func (c *core[K, S, R, A]) insert(key K, value S, weight int64, t time.Time) error {
+	var err error
+	if weight < 1 {
+		return ErrInvalid
+	}
+
+	sample, t0, ok := value, t, true
+	if c.opts.counterBits > 0 {
+		if value, t0, ok, err = c.count(key, value, t); err != nil {
+			return err
+		}
+	}
+
+	if ok { // The first sample of a counter only sets its baseline
+		if rec, found := c.db[key]; found {
+			err = rec.insert(value, weight, t, c.opts.overflow)
+		} else if rec, err = c.create(value, weight, t, c.opts); err == nil {
+			rec.head().stamp(t0)
+			rec.head().prevTime = t0
+			c.db[key] = rec
+		}
+	}
+
+	if err == nil {
+		if c.opts.counterBits > 0 {
+			c.counters[key] = counterSample[S]{time: t, value: sample}
+		}
+		c.evictor.touch(key)
+	}
+
+	return err
+}
+
+// InsertAt adds value to the aggregate functions of key with the timestamp t.
+// Timestamps may be out of order: the duration of a key spans its earliest
+// and latest timestamps, and values older than the previous window are not
+// added to the window.
+func (c *core[K, S, R, A]) InsertAt(key K, value S, t time.Time) error {
+	c.mu.Lock()
+	err := c.insert(key, value, 1, t)
+	evicted := c.evict(false)
+	c.mu.Unlock()
+
+	c.evictor.notify(evicted)
+	return err
+}
+
+// insertBatch inserts n samples, where sample returns the key, value and
+// weight of the sample i, under a single lock with the same timestamp.
+// Samples that cannot be inserted are skipped and the first error is
+// returned.
+func (c *core[K, S, R, A]) insertBatch(n int, sample func(i int) (K, S, int64)) error {
+	var err error
+	now := c.opts.clock.Now()
+
+	c.mu.Lock()
+	for i := 0; i < n; i++ {
+		key, value, weight := sample(i)
+		if e := c.insert(key, value, sampleWeight(weight), now); e != nil && err == nil {
+			err = e
+		}
+	}
+	evicted := c.evict(false)
+	c.mu.Unlock()
+
+	c.evictor.notify(evicted)
+	return err
+}
+
+// InsertWeighted adds value, the sum of weight observations such as the total
+// size of a batch of packets, to the aggregate functions of key. The count of
+// key increases by weight and the minimum and maximum are taken over the
+// average of the observations. It returns ErrInvalid if weight is less than
+// one.
+func (c *core[K, S, R, A]) InsertWeighted(key K, value S, weight int64) error {
+	now := c.opts.clock.Now()
+
+	c.mu.Lock()
+	err := c.insert(key, value, weight, now)
+	evicted := c.evict(false)
+	c.mu.Unlock()
+
+	c.evictor.notify(evicted)
+	return err
+}
+
+// Keys returns every key in unspecified order.
+func (c *core[K, S, R, A]) Keys() []K {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]K, 0, len(c.db))
+	for key := range c.db {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Range calls fn with the aggregate functions of every key, read under a
+// single lock, in unspecified order until fn returns false. The function fn
+// may use the aggregator.
+func (c *core[K, S, R, A]) Range(fn func(key K, agg A) bool) {
+	rangeSnapshot(c.Snapshot(), fn)
+}
+
+// Snapshot returns the aggregate functions of every key read under a single
+// lock.
+func (c *core[K, S, R, A]) Snapshot() map[K]A {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.snapshot()
+}
+
+// SnapshotAndReset returns the aggregate functions of every key and deletes
+// all keys atomically.
+func (c *core[K, S, R, A]) SnapshotAndReset() map[K]A {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snap := c.snapshot()
+	for key := range c.db {
+		if _, ok := c.counters[key]; !ok { // Baselines remain to be evicted
+			c.evictor.remove(key)
+		}
+	}
+	c.db = make(map[K]R)
+	return snap
+}
+
+func (c *core[K, S, R, A]) snapshot() map[K]A {
+	snap := make(map[K]A, len(c.db))
+	for key, rec := range c.db {
+		snap[key] = rec.aggregate()
+	}
+	return snap
+}
@@ -0,0 +1,64 @@
+package aggregator
+
+import (
+	"reflect"
+	"time"
+)
+
+// counterSample is the previous sample of a counter key.
+type counterSample[V any] struct {
+	time  time.Time
+	value V
+}
+
+// counterDelta returns the increase of a counter that wraps at 2^bits from
+// the sample last to the sample next. An integer counter that decreases has
+// wrapped if the increase modulo 2^bits is less than half of its range and
+// has otherwise been reset to zero, in which case next is the increase. A
+// floating-point counter that decreases has always been reset.
+func counterDelta[V Number](last, next V, bits int) V {
+	if next >= last {
+		return next - last
+	}
+
+	if isFloat[V]() {
+		return next
+	}
+
+	mask := ^uint64(0) >> (64 - bits)
+	if delta := (uint64(next) - uint64(last)) & mask; delta <= mask/2 {
+		return V(delta)
+	}
+
+	return next
+}
+
+// anyCounterDelta returns the increase of a counter of an Aggregator from the
+// sample last to the sample next as the type of next. It returns a
+// TypeMismatchError if the samples have different types and ErrNotSupported
+// for values of custom types.
+func anyCounterDelta(last, next interface{}, bits int) (interface{}, error) {
+	if reflect.TypeOf(next) != reflect.TypeOf(last) {
+		return nil, &TypeMismatchError{Expected: reflect.TypeOf(last), Received: reflect.TypeOf(next)}
+	}
+
+	n, err := convert(next)
+	if err != nil {
+		return nil, err
+	} else if _, ok := n.(Value); ok {
+		return nil, ErrNotSupported
+	}
+
+	var delta interface{}
+	l, _ := convert(last)
+	switch n := n.(type) {
+	case float64:
+		delta = counterDelta(l.(float64), n, bits)
+	case int64:
+		delta = counterDelta(l.(int64), n, bits)
+	case uint64:
+		delta = counterDelta(l.(uint64), n, bits)
+	}
+
+	return reflect.ValueOf(delta).Convert(reflect.TypeOf(next)).Interface(), nil
+}
@@ -0,0 +1,150 @@
+package aggregator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, uint64(5), counterDelta(uint64(10), 15, 64))
+	assert.Equal(t, uint64(20), counterDelta(uint64(math.MaxUint32-9), 10, 32))
+	assert.Equal(t, uint64(20), counterDelta(uint64(math.MaxUint64-9), 10, 64))
+	assert.Equal(t, uint64(10), counterDelta(uint64(1<<31), 10, 32))
+	assert.Equal(t, int64(3), counterDelta(int64(100), 3, 64))
+	assert.Equal(t, 2.5, counterDelta(100.0, 2.5, 64))
+}
+
+func TestTypedAggregator_WithCounter(t *testing.T) {
+	clock := &mockClock{now: time.Unix(100, 0)}
+	a := NewTypedAggregator[string, uint64](WithClock(clock), WithCounter(32))
+
+	assert.Nil(t, a.Insert("rx", math.MaxUint32-99))
+	_, err := a.Get("rx")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("rx", 100))
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("rx", 500))
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("rx", 100))
+
+	sum, err := a.GetSum("rx")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(700), sum)
+
+	dur, err := a.GetDuration("rx")
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, dur)
+
+	rate, err := a.GetRate("rx", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(233), rate)
+
+	a.SnapshotAndReset()
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("rx", 150))
+	agg, err := a.Get("rx")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), agg.Cnt)
+	assert.Equal(t, uint64(50), agg.Sum)
+
+	assert.Nil(t, a.Delete("rx"))
+	assert.Nil(t, a.Insert("rx", 1000))
+	_, err = a.Get("rx")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAggregator_WithCounter(t *testing.T) {
+	clock := &mockClock{now: time.Unix(100, 0)}
+	a := NewAggregator(WithClock(clock), WithCounter(32))
+
+	assert.Nil(t, a.Insert("rx", uint32(math.MaxUint32-9)))
+	_, err := a.Get("rx")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("rx", uint32(10)))
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("rx", uint32(40)))
+
+	agg, err := a.Get("rx")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), agg.Cnt)
+	assert.Equal(t, uint64(50), agg.Sum)
+	assert.Equal(t, uint32(20), agg.Min)
+	assert.Equal(t, uint32(30), agg.Max)
+
+	dur, err := a.GetDuration("rx")
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, dur)
+
+	var mismatch *TypeMismatchError
+	assert.ErrorAs(t, a.Insert("rx", 50), &mismatch)
+	assert.ErrorIs(t, a.Insert("c", complex(1, 1)), ErrNotSupported)
+
+	a.SnapshotAndReset()
+	assert.Nil(t, a.Insert("rx", uint32(45)))
+	sum, err := a.GetSum("rx")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), sum)
+}
+
+func TestWithCounter_Baselines(t *testing.T) {
+	clock := &mockClock{now: time.Unix(100, 0)}
+	var evicted []string
+	a := NewTypedAggregator[string, uint64](WithClock(clock), WithCounter(64), WithMaxKeys(2), WithTTL(time.Minute), WithEvictionCallback(func(key string, agg TypedAggregate[uint64], reason EvictionReason) {
+		evicted = append(evicted, key)
+	}))
+
+	// Keys with only a baseline are evicted by capacity
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Nil(t, a.Insert(key, 10))
+	}
+	assert.Equal(t, 2, len(a.counters))
+	_, ok := a.counters["a"]
+	assert.False(t, ok)
+
+	// and by TTL
+	clock.now = clock.now.Add(2 * time.Minute)
+	assert.Equal(t, 0, a.Expire())
+	assert.Equal(t, 0, len(a.counters))
+	assert.Nil(t, evicted)
+
+	// Delete removes a baseline without a record
+	assert.Nil(t, a.Insert("d", 10))
+	assert.Nil(t, a.Delete("d"))
+	assert.ErrorIs(t, a.Delete("d"), ErrNotFound)
+	assert.Nil(t, a.Insert("d", 30))
+	_, err := a.Get("d")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Baselines outlive resets
+	assert.Nil(t, a.Insert("d", 50))
+	assert.Equal(t, 1, len(a.SnapshotAndReset()))
+	clock.now = clock.now.Add(2 * time.Minute)
+	assert.Equal(t, 0, a.Expire())
+	assert.Equal(t, 0, len(a.counters))
+}
+
+func TestWithCounter_Overflow(t *testing.T) {
+	a := NewTypedAggregator[string, uint32](WithCounter(32), WithOverflowPolicy(OverflowError))
+	for _, value := range []uint32{0, math.MaxUint32 / 2, math.MaxUint32 - 1} {
+		assert.Nil(t, a.Insert("rx", value))
+	}
+
+	// A rejected increase leaves the baseline unchanged
+	assert.ErrorIs(t, a.Insert("rx", 9), ErrOverflow)
+	assert.Nil(t, a.Insert("rx", math.MaxUint32-1))
+
+	agg, err := a.Get("rx")
+	assert.Equal(t, TypedAggregate[uint32]{Avg: (math.MaxUint32 - 1) / 3, Cnt: 3, Max: math.MaxUint32 / 2, Min: 0, Sum: math.MaxUint32 - 1}, agg)
+	assert.Nil(t, err)
+}
+
+func TestWithCounter_Invalid(t *testing.T) {
+	assert.Panics(t, func() { WithCounter(16) })
+}
@@ -0,0 +1,62 @@
+package aggregator
+
+import (
+	"fmt"
+	"reflect"
+	"syscall"
+)
+
+// aggregatorError is a sentinel error that wraps a more general error. The
+// general sentinel errors wrap the errno values that the package returned
+// before it had sentinel errors, so errors.Is(ErrNotFound, syscall.ENOENT) is
+// true.
+type aggregatorError struct {
+	err error
+	msg string
+}
+
+func (e *aggregatorError) Error() string {
+	return "aggregator: " + e.msg
+}
+
+func (e *aggregatorError) Unwrap() error {
+	return e.err
+}
+
+var (
+	// ErrInvalid is returned for an invalid argument. It wraps EINVAL.
+	ErrInvalid error = &aggregatorError{err: syscall.EINVAL, msg: "invalid argument"}
+	// ErrNotFound is returned if a key does not exist. It wraps ENOENT.
+	ErrNotFound error = &aggregatorError{err: syscall.ENOENT, msg: "key not found"}
+	// ErrNotSupported is returned if a function is not available for a key,
+	// such as a window that is not enabled. It wraps ENOTSUP.
+	ErrNotSupported error = &aggregatorError{err: syscall.ENOTSUP, msg: "not supported"}
+	// ErrOverflow is returned if an integer result does not fit in its type.
+	// It wraps ERANGE.
+	ErrOverflow error = &aggregatorError{err: syscall.ERANGE, msg: "integer overflow"}
+
+	// ErrBoundsMismatch is returned when merging histograms with different
+	// bounds. It wraps ErrInvalid.
+	ErrBoundsMismatch error = &aggregatorError{err: ErrInvalid, msg: "histogram bounds mismatch"}
+	// ErrMalformedState is returned when decoding a malformed state or a state
+	// of a different value type. It wraps ErrInvalid.
+	ErrMalformedState error = &aggregatorError{err: ErrInvalid, msg: "malformed state"}
+	// ErrUnsupportedType is returned when inserting a value of a type that
+	// cannot be aggregated. It wraps ErrNotSupported.
+	ErrUnsupportedType error = &aggregatorError{err: ErrNotSupported, msg: "unsupported value type"}
+)
+
+// TypeMismatchError is returned when a value has a different type than the
+// values of the key it is inserted into or merged with. It wraps ErrInvalid.
+type TypeMismatchError struct {
+	Expected reflect.Type
+	Received reflect.Type
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("aggregator: value of type %v does not match key of type %v", e.Received, e.Expected)
+}
+
+func (e *TypeMismatchError) Unwrap() error {
+	return ErrInvalid
+}
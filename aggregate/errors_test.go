@@ -0,0 +1,37 @@
+package aggregator
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors_Errno(t *testing.T) {
+	assert.ErrorIs(t, ErrInvalid, syscall.EINVAL)
+	assert.ErrorIs(t, ErrNotFound, syscall.ENOENT)
+	assert.ErrorIs(t, ErrNotSupported, syscall.ENOTSUP)
+	assert.ErrorIs(t, ErrOverflow, syscall.ERANGE)
+	assert.ErrorIs(t, ErrBoundsMismatch, syscall.EINVAL)
+	assert.ErrorIs(t, ErrMalformedState, syscall.EINVAL)
+	assert.ErrorIs(t, ErrUnsupportedType, syscall.ENOTSUP)
+
+	assert.Equal(t, "aggregator: key not found", ErrNotFound.Error())
+}
+
+func TestTypeMismatchError(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", int32(1)))
+
+	err := a.Insert("key", int64(1))
+	assert.ErrorIs(t, err, ErrInvalid)
+	assert.ErrorIs(t, err, syscall.EINVAL)
+	assert.EqualError(t, err, "aggregator: value of type int64 does not match key of type int32")
+
+	var mismatch *TypeMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, reflect.TypeOf(int32(0)), mismatch.Expected)
+	assert.Equal(t, reflect.TypeOf(int64(0)), mismatch.Received)
+}
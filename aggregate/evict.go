@@ -0,0 +1,151 @@
+package aggregator
+
+import (
+	"container/list"
+	"time"
+)
+
+// EvictionReason describes why a key was evicted from an aggregator.
+type EvictionReason int
+
+const (
+	// EvictionExpired means that no value was inserted into the key for
+	// longer than the TTL of the aggregator.
+	EvictionExpired EvictionReason = iota
+	// EvictionCapacity means that the key was the least recently inserted key
+	// when the aggregator exceeded its maximum number of keys.
+	EvictionCapacity
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionExpired:
+		return "expired"
+	case EvictionCapacity:
+		return "capacity"
+	default:
+		return "unknown"
+	}
+}
+
+type eviction[K comparable, A any] struct {
+	agg    A
+	key    K
+	reason EvictionReason
+}
+
+// evictor orders keys by their last insert so that idle keys and the least
+// recently inserted keys can be evicted. A nil evictor evicts nothing.
+type evictor[K comparable, A any] struct {
+	elems   map[K]*list.Element
+	lru     *list.List
+	maxKeys int
+	onEvict func(key K, agg A, reason EvictionReason)
+	ttl     time.Duration
+}
+
+func newEvictor[K comparable, A any](opts *options) *evictor[K, A] {
+	if opts.maxKeys == 0 && opts.ttl == 0 {
+		return nil
+	}
+
+	e := &evictor[K, A]{
+		elems:   make(map[K]*list.Element),
+		lru:     list.New(),
+		maxKeys: opts.maxKeys,
+		ttl:     opts.ttl,
+	}
+
+	if opts.onEvict != nil {
+		fn, ok := opts.onEvict.(func(K, A, EvictionReason))
+		if !ok {
+			panic("eviction callback does not match the key and aggregate types")
+		}
+		e.onEvict = fn
+	}
+
+	return e
+}
+
+// evict removes keys that have been idle for longer than the TTL, scanning
+// every key if all is true or else only the least recently inserted keys, and
+// then removes the least recently inserted keys above the key limit. The
+// timeN function returns the latest timestamp of a key and remove deletes a
+// key from the aggregator and returns its final aggregate, or false if the
+// key has no aggregate to report, such as a counter with only a baseline.
+func (e *evictor[K, A]) evict(now time.Time, all bool, timeN func(K) time.Time, remove func(K) (A, bool)) []eviction[K, A] {
+	if e == nil {
+		return nil
+	}
+
+	var evicted []eviction[K, A]
+	if e.ttl > 0 {
+		for elem := e.lru.Front(); elem != nil; {
+			next := elem.Next()
+			key := elem.Value.(K)
+			if now.Sub(timeN(key)) > e.ttl {
+				if agg, ok := remove(key); ok {
+					evicted = append(evicted, eviction[K, A]{agg: agg, key: key, reason: EvictionExpired})
+				}
+				e.remove(key)
+			} else if !all {
+				break
+			}
+			elem = next
+		}
+	}
+
+	for e.maxKeys > 0 && e.lru.Len() > e.maxKeys {
+		key := e.lru.Front().Value.(K)
+		if agg, ok := remove(key); ok {
+			evicted = append(evicted, eviction[K, A]{agg: agg, key: key, reason: EvictionCapacity})
+		}
+		e.remove(key)
+	}
+
+	return evicted
+}
+
+// notify passes evicted keys to the eviction callback. It must be called
+// without holding the aggregator's lock so that the callback may use the
+// aggregator.
+func (e *evictor[K, A]) notify(evicted []eviction[K, A]) {
+	if e == nil || e.onEvict == nil {
+		return
+	}
+
+	for _, ev := range evicted {
+		e.onEvict(ev.key, ev.agg, ev.reason)
+	}
+}
+
+func (e *evictor[K, A]) remove(key K) {
+	if e == nil {
+		return
+	}
+
+	if elem, ok := e.elems[key]; ok {
+		e.lru.Remove(elem)
+		delete(e.elems, key)
+	}
+}
+
+func (e *evictor[K, A]) reset() {
+	if e != nil {
+		e.elems = make(map[K]*list.Element)
+		e.lru.Init()
+	}
+}
+
+// touch marks key as the most recently inserted key.
+func (e *evictor[K, A]) touch(key K) {
+	if e == nil {
+		return
+	}
+
+	if elem, ok := e.elems[key]; ok {
+		e.lru.MoveToBack(elem)
+	} else {
+		e.elems[key] = e.lru.PushBack(key)
+	}
+}
@@ -0,0 +1,106 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator_WithMaxKeys(t *testing.T) {
+	var keys []interface{}
+	var aggs []Aggregate
+	a := NewAggregator(WithMaxKeys(2), WithEvictionCallback(func(key interface{}, agg Aggregate, reason EvictionReason) {
+		assert.Equal(t, EvictionCapacity, reason)
+		keys = append(keys, key)
+		aggs = append(aggs, agg)
+	}))
+
+	assert.Nil(t, a.Insert("a", 1))
+	assert.Nil(t, a.Insert("b", 2))
+	assert.Nil(t, a.Insert("a", 3))
+	assert.Nil(t, a.Insert("c", 4))
+
+	assert.Equal(t, []interface{}{"b"}, keys)
+	assert.Equal(t, []Aggregate{{Avg: int64(2), Cnt: int64(1), Max: 2, Min: 2, Sum: int64(2)}}, aggs)
+	assert.Equal(t, 2, len(a.Snapshot()))
+
+	assert.Nil(t, a.Delete("a"))
+	assert.Nil(t, a.Insert("d", 5))
+	assert.Equal(t, []interface{}{"b"}, keys)
+
+	a.SnapshotAndReset()
+	assert.Nil(t, a.Insert("e", 6))
+	assert.Nil(t, a.Insert("f", 7))
+	assert.Equal(t, []interface{}{"b"}, keys)
+}
+
+func TestAggregator_WithTTL(t *testing.T) {
+	clock := &mockClock{now: time.Unix(100, 0)}
+	evicted := map[interface{}]Aggregate{}
+	a := NewAggregator(WithClock(clock), WithTTL(time.Minute), WithEvictionCallback(func(key interface{}, agg Aggregate, reason EvictionReason) {
+		assert.Equal(t, EvictionExpired, reason)
+		evicted[key] = agg
+	}))
+
+	assert.Nil(t, a.Insert("a", 1.5))
+	clock.now = clock.now.Add(30 * time.Second)
+	assert.Nil(t, a.Insert("b", 2.5))
+	clock.now = clock.now.Add(31 * time.Second)
+	assert.Nil(t, a.Insert("b", 3.5))
+
+	assert.Equal(t, map[interface{}]Aggregate{"a": {Avg: 1.5, Cnt: int64(1), Max: 1.5, Min: 1.5, Sum: 1.5}}, evicted)
+	_, err := a.Get("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	clock.now = clock.now.Add(time.Hour)
+	assert.Equal(t, 1, a.Expire())
+	assert.Equal(t, 0, len(a.Snapshot()))
+	assert.Equal(t, 2, len(evicted))
+}
+
+func TestTypedAggregator_WithTTL(t *testing.T) {
+	clock := &mockClock{now: time.Unix(100, 0)}
+	var keys []string
+	a := NewTypedAggregator[string, int64](WithClock(clock), WithTTL(time.Minute), WithEvictionCallback(func(key string, agg TypedAggregate[int64], reason EvictionReason) {
+		keys = append(keys, key)
+	}))
+
+	// A key inserted out of order is expired by Expire rather than Insert
+	assert.Nil(t, a.Insert("a", 1))
+	assert.Nil(t, a.InsertAt("b", 1, clock.now.Add(-time.Hour)))
+	assert.Nil(t, a.Insert("c", 1))
+	assert.Nil(t, keys)
+
+	assert.Equal(t, 1, a.Expire())
+	assert.Equal(t, []string{"b"}, keys)
+	assert.Equal(t, 0, a.Expire())
+}
+
+func TestTypedAggregator_WithMaxKeys_Callback(t *testing.T) {
+	var a *TypedAggregator[int, float64]
+	a = NewTypedAggregator[int, float64](WithMaxKeys(1), WithEvictionCallback(func(key int, agg TypedAggregate[float64], reason EvictionReason) {
+		// The aggregator is unlocked while the callback runs
+		assert.Equal(t, 1, len(a.Snapshot()))
+	}))
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, a.Insert(i, float64(i)))
+	}
+	assert.Equal(t, map[int]TypedAggregate[float64]{3: {Avg: 3, Cnt: 1, Max: 3, Min: 3, Sum: 3}}, a.Snapshot())
+}
+
+func TestWithEvictionCallback_Invalid(t *testing.T) {
+	assert.Panics(t, func() { WithEvictionCallback[string, Aggregate](nil) })
+	assert.Panics(t, func() {
+		NewTypedAggregator[string, int64](WithMaxKeys(1), WithEvictionCallback(func(key interface{}, agg Aggregate, reason EvictionReason) {}))
+	})
+	assert.Panics(t, func() { WithMaxKeys(0) })
+	assert.Panics(t, func() { WithTTL(0) })
+}
+
+func TestEvictionReason_String(t *testing.T) {
+	assert.Equal(t, "expired", EvictionExpired.String())
+	assert.Equal(t, "capacity", EvictionCapacity.String())
+	assert.Equal(t, "unknown", EvictionReason(-1).String())
+}
@@ -0,0 +1,55 @@
+package aggregator
+
+import (
+	"math"
+	"time"
+)
+
+// ewma is an exponentially weighted moving average in which the weight of a
+// value halves every halfLife after it is inserted. The decayed sum of the
+// values also gives a smoothed rate, similar to a load average.
+type ewma struct {
+	halfLife time.Duration
+	sum      float64
+	time     time.Time
+	weight   float64
+}
+
+// newEWMA returns an ewma of weight values whose sum is sum.
+func newEWMA(halfLife time.Duration, sum, weight float64, now time.Time) *ewma {
+	return &ewma{halfLife: halfLife, sum: sum, time: now, weight: weight}
+}
+
+func (e *ewma) decay(elapsed time.Duration) float64 {
+	return math.Exp2(-float64(elapsed) / float64(e.halfLife))
+}
+
+func (e *ewma) average() float64 {
+	if e.weight == 0 {
+		return 0
+	}
+	return e.sum / e.weight
+}
+
+// add inserts weight values whose sum is sum.
+func (e *ewma) add(sum, weight float64, now time.Time) {
+	if elapsed := now.Sub(e.time); elapsed >= 0 {
+		d := e.decay(elapsed)
+		e.sum = e.sum*d + sum
+		e.weight = e.weight*d + weight
+		e.time = now
+	} else { // Out-of-order values have already decayed
+		d := e.decay(-elapsed)
+		e.sum += sum * d
+		e.weight += weight * d
+	}
+}
+
+// rate returns the smoothed rate at time now scaled to the duration dur.
+func (e *ewma) rate(now time.Time, dur time.Duration) float64 {
+	sum := e.sum
+	if elapsed := now.Sub(e.time); elapsed > 0 {
+		sum *= e.decay(elapsed)
+	}
+	return sum * math.Ln2 * float64(dur) / float64(e.halfLife)
+}
@@ -0,0 +1,43 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEWMA_Average(t *testing.T) {
+	t0 := time.Unix(0, 0)
+	e := newEWMA(time.Second, 10, 1, t0)
+	assert.Equal(t, float64(10), e.average())
+
+	// Values inserted at the same time are weighted equally
+	e.add(20, 1, t0)
+	assert.Equal(t, float64(15), e.average())
+
+	// The weight of the previous values halves after one half-life
+	e.add(30, 1, t0.Add(time.Second))
+	assert.InDelta(t, float64(22.5), e.average(), 1e-9)
+
+	// Out-of-order values are inserted with their decayed weight
+	e.add(0, 1, t0)
+	assert.InDelta(t, float64(18), e.average(), 1e-9)
+}
+
+func TestEWMA_Rate(t *testing.T) {
+	t0 := time.Unix(0, 0)
+	e := newEWMA(10*time.Second, 100, 1, t0)
+
+	// A steady 1000 units per second converges to a rate of 1000/s
+	for i := 1; i <= 1000; i++ {
+		e.add(100, 1, t0.Add(time.Duration(i)*100*time.Millisecond))
+	}
+
+	now := t0.Add(100 * time.Second)
+	assert.InEpsilon(t, float64(1000), e.rate(now, time.Second), 0.01)
+	assert.InEpsilon(t, float64(60000), e.rate(now, time.Minute), 0.01)
+
+	// The rate halves after one half-life without inserts
+	assert.InEpsilon(t, float64(500), e.rate(now.Add(10*time.Second), time.Second), 0.01)
+}
@@ -0,0 +1,194 @@
+package aggregator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shanebarnes/goto/units"
+)
+
+// FormatStyle selects the output of a Formatter.
+type FormatStyle int
+
+const (
+	// FormatTable renders rows as a text table with aligned columns.
+	FormatTable FormatStyle = iota
+	// FormatCSV renders rows as comma-separated values with a header.
+	FormatCSV
+	// FormatJSON renders rows as a JSON array of objects.
+	FormatJSON
+)
+
+// Row is a key and its aggregate functions converted to float64 for
+// formatting. Values that are not real numbers, such as complex values, are
+// NaN.
+type Row struct {
+	Avg      float64
+	Count    int64
+	Duration time.Duration
+	Key      string
+	Max      float64
+	Min      float64
+	Rate     float64 // Sum per second over Duration
+	Sum      float64
+}
+
+// toFloat converts a value returned by an Aggregator to float64. Values that
+// are not real numbers are converted to NaN.
+func toFloat(value interface{}) float64 {
+	f, ok := toReal(value)
+	if !ok {
+		return math.NaN()
+	}
+	return f
+}
+
+// toReal converts a value returned by an Aggregator to float64. It returns
+// false if the value is not a real number.
+func toReal(value interface{}) (float64, bool) {
+	if b, ok := value.(*big.Int); ok {
+		f, _ := new(big.Float).SetInt(b).Float64()
+		return f, true
+	}
+
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+func newRow(key interface{}, cnt int64, avg, max, min, sum float64, dur time.Duration) Row {
+	row := Row{Avg: avg, Count: cnt, Duration: dur, Key: fmt.Sprint(key), Max: max, Min: min, Sum: sum}
+	if dur > 0 {
+		row.Rate = sum / dur.Seconds()
+	}
+	return row
+}
+
+// NewRow returns the row of a key of an Aggregator whose values span the
+// duration dur. For a report, dur is typically the interval of the report.
+func NewRow(key interface{}, agg Aggregate, dur time.Duration) Row {
+	cnt, _ := agg.Cnt.(int64)
+	return newRow(key, cnt, toFloat(agg.Avg), toFloat(agg.Max), toFloat(agg.Min), toFloat(agg.Sum), dur)
+}
+
+// NewTypedRow returns the row of a key of a TypedAggregator whose values span
+// the duration dur.
+func NewTypedRow[K comparable, V Number](key K, agg TypedAggregate[V], dur time.Duration) Row {
+	return newRow(key, agg.Cnt, float64(agg.Avg), float64(agg.Max), float64(agg.Min), float64(agg.Sum), dur)
+}
+
+// BinaryUnit returns a function that renders a number with a binary prefix
+// and the given quantity, such as 12.3 MiB.
+func BinaryUnit(quantity string, precision int) func(v float64) string {
+	return func(v float64) string {
+		return strings.TrimSpace(units.ToBinaryString(v, precision, " ", quantity))
+	}
+}
+
+// MetricUnit returns a function that renders a number with a metric prefix
+// and the given quantity, such as 95.4 Mb/s.
+func MetricUnit(quantity string, precision int) func(v float64) string {
+	return func(v float64) string {
+		return strings.TrimSpace(units.ToMetricString(v, precision, " ", quantity))
+	}
+}
+
+// Formatter renders rows as a text table, CSV or JSON. Numbers are scaled by
+// the Value and Rate functions and durations are rendered by
+// units.ToTimeString.
+type Formatter struct {
+	// Rate renders the rate of a key, which is per second.
+	Rate func(v float64) string
+	// Style is the output format.
+	Style FormatStyle
+	// Value renders the sum, average, minimum and maximum of a key.
+	Value func(v float64) string
+}
+
+// NewFormatter creates and returns a new Formatter instance that renders
+// numbers with metric prefixes.
+func NewFormatter(style FormatStyle) *Formatter {
+	return &Formatter{Rate: MetricUnit("/s", 3), Style: style, Value: MetricUnit("", 3)}
+}
+
+var formatHeader = []string{"key", "count", "sum", "avg", "min", "max", "duration", "rate"}
+
+func (f *Formatter) cells(row Row) []string {
+	value := func(render func(float64) string, v float64) string {
+		if math.IsNaN(v) {
+			return "-"
+		}
+		return render(v)
+	}
+
+	return []string{
+		row.Key,
+		strconv.FormatInt(row.Count, 10),
+		value(f.Value, row.Sum),
+		value(f.Value, row.Avg),
+		value(f.Value, row.Min),
+		value(f.Value, row.Max),
+		units.ToTimeString(row.Duration.Seconds()),
+		value(f.Rate, row.Rate),
+	}
+}
+
+// Write renders rows to w sorted by key.
+func (f *Formatter) Write(w io.Writer, rows []Row) error {
+	sorted := make([]Row, len(rows))
+	copy(sorted, rows)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	switch f.Style {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(formatHeader)
+		for _, row := range sorted {
+			cw.Write(f.cells(row))
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSON:
+		type jsonRow struct {
+			Key      string `json:"key"`
+			Count    int64  `json:"count"`
+			Sum      string `json:"sum"`
+			Avg      string `json:"avg"`
+			Min      string `json:"min"`
+			Max      string `json:"max"`
+			Duration string `json:"duration"`
+			Rate     string `json:"rate"`
+		}
+
+		objs := make([]jsonRow, len(sorted))
+		for i, row := range sorted {
+			c := f.cells(row)
+			objs[i] = jsonRow{Key: c[0], Count: row.Count, Sum: c[2], Avg: c[3], Min: c[4], Max: c[5], Duration: c[6], Rate: c[7]}
+		}
+		return json.NewEncoder(w).Encode(objs)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(formatHeader, "\t")))
+		for _, row := range sorted {
+			fmt.Fprintln(tw, strings.Join(f.cells(row), "\t"))
+		}
+		return tw.Flush()
+	}
+}
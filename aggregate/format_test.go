@@ -0,0 +1,79 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatter_Table(t *testing.T) {
+	f := NewFormatter(FormatTable)
+	f.Value = BinaryUnit("B", 1)
+	f.Rate = func(v float64) string { return MetricUnit("b/s", 1)(v * 8) }
+
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, map[interface{}]interface{}{"eth0": uint64(12 * 1024 * 1024)}, nil, map[interface{}]interface{}{"eth0": uint64(1024), "lo": 1.5})
+
+	var b bytes.Buffer
+	assert.Nil(t, f.Write(&b, a.Rows()))
+	assert.Equal(t, ""+
+		"KEY   COUNT  SUM       AVG      MIN      MAX       DURATION              RATE\n"+
+		"eth0  2      12.0 MiB  6.0 MiB  1.0 KiB  12.0 MiB  0.00:00:02.000000000  50.3 Mb/s\n"+
+		"lo    1      1.5 B     1.5 B    1.5 B    1.5 B     0.00:00:00.000000000  0.0 b/s\n", b.String())
+}
+
+func TestFormatter_CSV(t *testing.T) {
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, map[interface{}]interface{}{"eth0": uint64(12 * 1024 * 1024)}, nil, map[interface{}]interface{}{"eth0": uint64(1024), "lo": 1.5})
+
+	var b bytes.Buffer
+	assert.Nil(t, NewFormatter(FormatCSV).Write(&b, a.Rows()))
+	assert.Equal(t, ""+
+		"key,count,sum,avg,min,max,duration,rate\n"+
+		"eth0,2,12.584 M,6.292 M,1.024 k,12.583 M,0.00:00:02.000000000,6.292 M/s\n"+
+		"lo,1,1.500,1.500,1.500,1.500,0.00:00:00.000000000,0.000 /s\n", b.String())
+}
+
+func TestFormatter_JSON(t *testing.T) {
+	a := NewTypedAggregator[string, time.Duration]()
+	assert.Nil(t, a.InsertAt("rtt", 1500*time.Microsecond, time.Unix(0, 0)))
+
+	f := NewFormatter(FormatJSON)
+	f.Value = func(v float64) string { return MetricUnit("s", 1)(v / 1e9) }
+
+	var b bytes.Buffer
+	assert.Nil(t, f.Write(&b, a.Rows()))
+	assert.Equal(t, `[{"key":"rtt","count":1,"sum":"1.5 ms","avg":"1.5 ms","min":"1.5 ms","max":"1.5 ms","duration":"0.00:00:00.000000000","rate":"0.000 /s"}]`+"\n", b.String())
+}
+
+func TestFormatter_Report(t *testing.T) {
+	var b bytes.Buffer
+	f := NewFormatter(FormatCSV)
+	a := NewAggregator()
+	r := NewReporter[interface{}, Aggregate](a, time.Second, ReportDelta, SinkFunc[interface{}, Aggregate](func(ctx context.Context, report Report[interface{}, Aggregate]) error {
+		var rows []Row
+		for key, agg := range report.Aggregates {
+			rows = append(rows, NewRow(key, agg, report.End.Sub(report.Start)))
+		}
+		return f.Write(&b, rows)
+	}))
+
+	assert.Nil(t, a.Insert("key", complex(1, 1)))
+	assert.Nil(t, r.Report(context.Background()))
+	assert.Contains(t, b.String(), "\nkey,1,-,-,-,-,")
+}
+
+func TestNewRow(t *testing.T) {
+	row := NewRow(1, Aggregate{Avg: big.NewInt(2), Cnt: int64(1), Max: int8(-1), Min: struct{}{}, Sum: uint32(4)}, 2*time.Second)
+	assert.Equal(t, "1", row.Key)
+	assert.Equal(t, float64(2), row.Avg)
+	assert.Equal(t, float64(-1), row.Max)
+	assert.True(t, math.IsNaN(row.Min))
+	assert.Equal(t, float64(4), row.Sum)
+	assert.Equal(t, float64(2), row.Rate)
+}
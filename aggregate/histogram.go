@@ -0,0 +1,100 @@
+package aggregator
+
+import (
+	"slices"
+)
+
+// Histogram counts values in buckets with fixed upper bounds. Counts[i] is the
+// number of values v with Bounds[i-1] < v <= Bounds[i], and the last count is
+// the number of values greater than every bound.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+}
+
+// ExponentialBuckets returns count bounds where the first bound is start and
+// each subsequent bound is the previous bound multiplied by factor.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if start <= 0 || factor <= 1 || count < 1 {
+		panic("exponential buckets require start > 0, factor > 1 and count > 0")
+	}
+
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// LinearBuckets returns count bounds where the first bound is start and each
+// subsequent bound is the previous bound plus width.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if width <= 0 || count < 1 {
+		panic("linear buckets require width > 0 and count > 0")
+	}
+
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// LogLinearBuckets returns HDR-style bounds from min to at least max: each
+// power-of-two range [m, 2m) starting at min is divided into subBuckets
+// buckets of equal width, which bounds the relative error of every bucket.
+func LogLinearBuckets(min, max float64, subBuckets int) []float64 {
+	if min <= 0 || max <= min || subBuckets < 1 {
+		panic("log-linear buckets require 0 < min < max and subBuckets > 0")
+	}
+
+	bounds := []float64{min}
+	for m := min; m < max; m *= 2 {
+		for i := 1; i <= subBuckets; i++ {
+			bounds = append(bounds, m+float64(i)*m/float64(subBuckets))
+		}
+	}
+	return bounds
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)}
+}
+
+// add inserts n values equal to value.
+func (h *Histogram) add(value float64, n uint64) {
+	i, _ := slices.BinarySearch(h.Bounds, value)
+	h.Counts[i] += n
+}
+
+func (h *Histogram) clone() Histogram {
+	return Histogram{Bounds: slices.Clone(h.Bounds), Counts: slices.Clone(h.Counts)}
+}
+
+// Count returns the total number of values in the histogram.
+func (h Histogram) Count() uint64 {
+	var n uint64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Merge adds the counts of other to the histogram. A zero Histogram takes the
+// bounds of other. It returns ErrBoundsMismatch if the histograms have different bounds.
+func (h *Histogram) Merge(other Histogram) error {
+	if h.Bounds == nil && h.Counts == nil {
+		*h = other.clone()
+		return nil
+	}
+
+	if !slices.Equal(h.Bounds, other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return ErrBoundsMismatch
+	}
+
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package aggregator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBuckets(t *testing.T) {
+	assert.Equal(t, []float64{1, 2, 4, 8}, ExponentialBuckets(1, 2, 4))
+	assert.Panics(t, func() { ExponentialBuckets(0, 2, 4) })
+	assert.Panics(t, func() { ExponentialBuckets(1, 1, 4) })
+}
+
+func TestLinearBuckets(t *testing.T) {
+	assert.Equal(t, []float64{-10, 0, 10}, LinearBuckets(-10, 10, 3))
+	assert.Panics(t, func() { LinearBuckets(0, 0, 3) })
+}
+
+func TestLogLinearBuckets(t *testing.T) {
+	assert.Equal(t, []float64{1, 1.5, 2, 3, 4, 6, 8}, LogLinearBuckets(1, 5, 2))
+	assert.Panics(t, func() { LogLinearBuckets(1, 1, 2) })
+}
+
+func TestHistogram_Insert(t *testing.T) {
+	h := newHistogram([]float64{1, 10, 100})
+	for _, value := range []float64{-5, 1, 1.5, 10, 99, 100, 101, 1e9} {
+		h.add(value, 1)
+	}
+
+	assert.Equal(t, []uint64{2, 2, 2, 2}, h.Counts)
+	assert.Equal(t, uint64(8), h.Count())
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	var h Histogram
+	assert.Nil(t, h.Merge(Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 2, 3}}))
+	assert.Nil(t, h.Merge(Histogram{Bounds: []float64{1, 2}, Counts: []uint64{4, 5, 6}}))
+	assert.Equal(t, Histogram{Bounds: []float64{1, 2}, Counts: []uint64{5, 7, 9}}, h)
+
+	assert.ErrorIs(t, h.Merge(Histogram{Bounds: []float64{1, 3}, Counts: []uint64{1, 1, 1}}), ErrBoundsMismatch)
+	assert.Equal(t, []uint64{5, 7, 9}, h.Counts)
+}
+
+func TestWithHistogram_Invalid(t *testing.T) {
+	assert.Panics(t, func() { WithHistogram(nil) })
+	assert.Panics(t, func() { WithHistogram([]float64{2, 1}) })
+}
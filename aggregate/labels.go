@@ -0,0 +1,205 @@
+package aggregator
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels is a set of label names and values, such as host="a",dir="rx", that
+// identifies a key with several dimensions. Labels are comparable and can be
+// used as the key of any aggregator: two sets with the same names and values
+// are equal regardless of the order in which the labels were given.
+type Labels struct {
+	s string // Sorted name="quoted value" pairs separated by commas
+}
+
+// NewLabels creates and returns labels from alternating names and values.
+func NewLabels(pairs ...string) Labels {
+	if len(pairs)%2 != 0 {
+		panic("labels require a value for every name")
+	}
+
+	m := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := m[pairs[i]]; ok {
+			panic("duplicate label name: " + pairs[i])
+		}
+		m[pairs[i]] = pairs[i+1]
+	}
+
+	return LabelsFromMap(m)
+}
+
+// LabelsFromMap creates and returns labels from a map of names to values.
+func LabelsFromMap(m map[string]string) Labels {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		if !labelNameRegexp.MatchString(name) {
+			panic("invalid label name: " + name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + "=" + strconv.Quote(m[name]))
+	}
+
+	return Labels{s: b.String()}
+}
+
+// each calls fn with the name and quoted value of every label in order.
+func (l Labels) each(fn func(name, quoted string)) {
+	for s := l.s; s != ""; {
+		i := strings.IndexByte(s, '=')
+		quoted, _ := strconv.QuotedPrefix(s[i+1:])
+		fn(s[:i], quoted)
+		s = strings.TrimPrefix(s[i+1+len(quoted):], ",")
+	}
+}
+
+// Get returns the value of the label with the given name.
+func (l Labels) Get(name string) (string, bool) {
+	var value string
+	var ok bool
+
+	l.each(func(n, quoted string) {
+		if n == name {
+			value, _ = strconv.Unquote(quoted)
+			ok = true
+		}
+	})
+
+	return value, ok
+}
+
+// Keep returns the labels with the given names. Names that are not labels are
+// ignored.
+func (l Labels) Keep(names ...string) Labels {
+	var pairs []string
+	l.each(func(name, quoted string) {
+		for _, n := range names {
+			if n == name {
+				pairs = append(pairs, name+"="+quoted)
+				break
+			}
+		}
+	})
+
+	return Labels{s: strings.Join(pairs, ",")}
+}
+
+// Len returns the number of labels.
+func (l Labels) Len() int {
+	n := 0
+	l.each(func(string, string) { n++ })
+	return n
+}
+
+// Map returns the labels as a map of names to values.
+func (l Labels) Map() map[string]string {
+	m := make(map[string]string)
+	l.each(func(name, quoted string) {
+		m[name], _ = strconv.Unquote(quoted)
+	})
+	return m
+}
+
+// MarshalBinary encodes the labels in the form returned by String.
+func (l Labels) MarshalBinary() ([]byte, error) {
+	return l.MarshalText()
+}
+
+// MarshalText encodes the labels in the form returned by String.
+func (l Labels) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l Labels) String() string {
+	return "{" + l.s + "}"
+}
+
+// UnmarshalBinary decodes labels encoded by MarshalBinary.
+func (l *Labels) UnmarshalBinary(data []byte) error {
+	return l.UnmarshalText(data)
+}
+
+// UnmarshalText decodes labels encoded by MarshalText.
+func (l *Labels) UnmarshalText(text []byte) error {
+	s := string(text)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return ErrInvalid
+	}
+	s = s[1 : len(s)-1]
+
+	m := make(map[string]string)
+	for s != "" {
+		i := strings.IndexByte(s, '=')
+		if i < 0 || !labelNameRegexp.MatchString(s[:i]) {
+			return ErrInvalid
+		}
+
+		quoted, err := strconv.QuotedPrefix(s[i+1:])
+		if err != nil {
+			return ErrInvalid
+		}
+
+		name := s[:i]
+		if _, ok := m[name]; ok {
+			return ErrInvalid
+		}
+		m[name], _ = strconv.Unquote(quoted)
+
+		s = s[i+1+len(quoted):]
+		if s != "" {
+			var ok bool
+			if s, ok = strings.CutPrefix(s, ","); !ok || s == "" {
+				return ErrInvalid
+			}
+		}
+	}
+
+	*l = LabelsFromMap(m)
+	return nil
+}
+
+// RollUp groups states, typically exported from a TypedAggregator or
+// ShardedAggregator keyed by Labels, by the labels with the given names and
+// returns the combined aggregate functions of each group. Grouping by no
+// names combines every state. States that cannot be combined are skipped and
+// the first error is returned.
+func RollUp[V Number](states map[Labels]State[V], names ...string) (map[Labels]TypedAggregate[V], error) {
+	var err error
+	groups := make(map[Labels]*record[V])
+	opts := newOptions(nil)
+
+	for labels, s := range states {
+		group := labels.Keep(names...)
+
+		var e error
+		if rec, ok := groups[group]; ok {
+			e = rec.mergeState(s, opts.overflow)
+		} else if rec, e = newRecordFromState(s, opts); e == nil {
+			groups[group] = rec
+		}
+
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	rollup := make(map[Labels]TypedAggregate[V], len(groups))
+	for group, rec := range groups {
+		rollup[group] = rec.aggregate()
+	}
+
+	return rollup, err
+}
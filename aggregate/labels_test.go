@@ -0,0 +1,103 @@
+package aggregator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	l := NewLabels("host", "a", "dir", "rx", "if", `eth"0",x`)
+	assert.Equal(t, LabelsFromMap(map[string]string{"dir": "rx", "host": "a", "if": `eth"0",x`}), l)
+	assert.Equal(t, `{dir="rx",host="a",if="eth\"0\",x"}`, l.String())
+	assert.Equal(t, 3, l.Len())
+	assert.Equal(t, map[string]string{"dir": "rx", "host": "a", "if": `eth"0",x`}, l.Map())
+
+	v, ok := l.Get("if")
+	assert.Equal(t, `eth"0",x`, v)
+	assert.True(t, ok)
+
+	_, ok = l.Get("missing")
+	assert.False(t, ok)
+
+	assert.Equal(t, NewLabels("host", "a", "if", `eth"0",x`), l.Keep("if", "host", "missing"))
+	assert.Equal(t, Labels{}, l.Keep())
+	assert.Equal(t, 0, Labels{}.Len())
+}
+
+func TestLabels_Invalid(t *testing.T) {
+	assert.Panics(t, func() { NewLabels("host") })
+	assert.Panics(t, func() { NewLabels("host", "a", "host", "b") })
+	assert.Panics(t, func() { NewLabels("0host", "a") })
+}
+
+func TestAggregator_RollUp(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert(NewLabels("host", "a", "dir", "rx"), uint32(1)))
+	assert.Nil(t, a.Insert(NewLabels("host", "a", "dir", "tx"), uint32(2)))
+	assert.Nil(t, a.Insert(NewLabels("host", "b", "dir", "rx"), uint32(4)))
+	assert.Nil(t, a.Insert(NewLabels("host", "b", "dir", "rx"), uint32(8)))
+	assert.Nil(t, a.Insert("other", 100))
+
+	rollup, err := a.RollUp("host")
+	assert.Equal(t, map[Labels]Aggregate{
+		NewLabels("host", "a"): {Avg: uint64(1), Cnt: int64(2), Max: uint32(2), Min: uint32(1), Sum: uint64(3)},
+		NewLabels("host", "b"): {Avg: uint64(6), Cnt: int64(2), Max: uint32(8), Min: uint32(4), Sum: uint64(12)},
+	}, rollup)
+	assert.Nil(t, err)
+
+	rollup, err = a.RollUp()
+	assert.Equal(t, map[Labels]Aggregate{
+		{}: {Avg: uint64(3), Cnt: int64(4), Max: uint32(8), Min: uint32(1), Sum: uint64(15)},
+	}, rollup)
+	assert.Nil(t, err)
+
+	// The roll-up does not modify the aggregator
+	agg, err := a.Get(NewLabels("host", "a", "dir", "rx"))
+	assert.Equal(t, int64(1), agg.Cnt)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.Insert(NewLabels("host", "c", "dir", "rx"), 1.5))
+	_, err = a.RollUp("dir")
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestRollUp(t *testing.T) {
+	a := NewShardedAggregator[Labels, float64](4)
+	for _, host := range []string{"a", "b"} {
+		for i, dir := range []string{"rx", "tx"} {
+			assert.Nil(t, a.Insert(NewLabels("host", host, "dir", dir), float64(i)))
+			assert.Nil(t, a.Insert(NewLabels("host", host, "dir", dir), float64(i+2)))
+		}
+	}
+
+	rollup, err := RollUp(a.Export(), "dir")
+	assert.Equal(t, map[Labels]TypedAggregate[float64]{
+		NewLabels("dir", "rx"): {Avg: 1, Cnt: 4, Max: 2, Min: 0, Sum: 4},
+		NewLabels("dir", "tx"): {Avg: 2, Cnt: 4, Max: 3, Min: 1, Sum: 8},
+	}, rollup)
+	assert.Nil(t, err)
+
+	rollup, err = RollUp(map[Labels]State[float64]{NewLabels("dir", "rx"): {}})
+	assert.Equal(t, map[Labels]TypedAggregate[float64]{}, rollup)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestLabels_MarshalText(t *testing.T) {
+	for _, l := range []Labels{{}, NewLabels("host", "a"), NewLabels("host", "a", "if", `eth"0",x`)} {
+		text, err := l.MarshalText()
+		assert.Nil(t, err)
+
+		var d Labels
+		assert.Nil(t, d.UnmarshalText(text))
+		assert.Equal(t, l, d)
+	}
+
+	var l Labels
+	assert.Nil(t, l.UnmarshalText([]byte(`{if="eth0",host="a"}`)))
+	assert.Equal(t, NewLabels("host", "a", "if", "eth0"), l)
+
+	for _, text := range []string{``, `host="a"`, `{host="a"`, `{host=a}`, `{0host="a"}`, `{host="a",}`, `{host="a"host="b"}`, `{host="a",host="b"}`} {
+		assert.ErrorIs(t, l.UnmarshalText([]byte(text)), ErrInvalid, text)
+	}
+}
@@ -0,0 +1,223 @@
+package aggregator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Source is an aggregator whose keys can be exported, such as a
+// TypedAggregator, a ShardedAggregator or, with NewAggregatorSource, an
+// Aggregator.
+type Source[K comparable, V Number] interface {
+	GetPercentile(key K, q float64) (float64, error)
+	Snapshot() map[K]TypedAggregate[V]
+}
+
+// aggregatorSource is the Source of an Aggregator.
+type aggregatorSource struct {
+	*Aggregator
+}
+
+// NewAggregatorSource returns a Source that exports the keys of a as float64
+// values, so that an Aggregator can be exported with an Exporter. Keys whose
+// values are not real numbers, such as complex or custom values, are skipped.
+func NewAggregatorSource(a *Aggregator) Source[interface{}, float64] {
+	return aggregatorSource{a}
+}
+
+func (s aggregatorSource) Snapshot() map[interface{}]TypedAggregate[float64] {
+	snap := s.Aggregator.Snapshot()
+	typed := make(map[interface{}]TypedAggregate[float64], len(snap))
+	for key, agg := range snap {
+		// The values of a key are all of the type of its first value
+		if _, ok := toReal(agg.Sum); ok {
+			cnt, _ := agg.Cnt.(int64)
+			typed[key] = TypedAggregate[float64]{Avg: toFloat(agg.Avg), Cnt: cnt, Max: toFloat(agg.Max), Min: toFloat(agg.Min), Sum: toFloat(agg.Sum)}
+		}
+	}
+	return typed
+}
+
+// Exporter renders every key of an aggregator in the OpenMetrics or
+// Prometheus text exposition format. The count, sum and percentiles of a key
+// are exported as a summary and its minimum, maximum and average as gauges.
+// The sum of a summary is a counter, so it is omitted for keys whose sum is
+// negative or NaN.
+type Exporter[K comparable, V Number] struct {
+	// Quantiles are the quantiles exported by the summary.
+	Quantiles []float64
+
+	help   string
+	labels func(key K) map[string]string
+	name   string
+	source Source[K, V]
+}
+
+// NewExporter creates and returns a new Exporter instance. The labels function
+// maps a key to the labels of its metrics; if it is nil then each key is
+// exported with a single label named "key". The exporter panics if a label
+// name is invalid or is "quantile", which is the label of the percentiles.
+func NewExporter[K comparable, V Number](source Source[K, V], name, help string, labels func(key K) map[string]string) *Exporter[K, V] {
+	if !metricNameRegexp.MatchString(name) {
+		panic("invalid metric name: " + name)
+	}
+
+	if labels == nil {
+		labels = func(key K) map[string]string {
+			return map[string]string{"key": fmt.Sprint(key)}
+		}
+	}
+
+	return &Exporter[K, V]{
+		Quantiles: []float64{0.5, 0.9, 0.99},
+		help:      help,
+		labels:    labels,
+		name:      name,
+		source:    source,
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+func (e *Exporter[K, V]) formatLabels(key K) string {
+	labels := e.labels(key)
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		if !labelNameRegexp.MatchString(name) || name == "quantile" {
+			panic("invalid label name: " + name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabelValue(labels[name]) + `"`
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func writeSample(b *bytes.Buffer, name, labels string, value float64) {
+	b.WriteString(name)
+	if labels != "" {
+		b.WriteString("{" + labels + "}")
+	}
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func (e *Exporter[K, V]) render(openMetrics bool) []byte {
+	type series struct {
+		agg         TypedAggregate[V]
+		labels      string
+		percentiles []float64
+	}
+
+	snap := e.source.Snapshot()
+	all := make([]series, 0, len(snap))
+	for key, agg := range snap {
+		s := series{agg: agg, labels: e.formatLabels(key)}
+		for _, q := range e.Quantiles {
+			p, err := e.source.GetPercentile(key, q)
+			if err != nil {
+				s.percentiles = nil
+				break
+			}
+			s.percentiles = append(s.percentiles, p)
+		}
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].labels < all[j].labels })
+
+	var b bytes.Buffer
+	if e.help != "" {
+		b.WriteString("# HELP " + e.name + " " + escapeHelp(e.help) + "\n")
+	}
+	b.WriteString("# TYPE " + e.name + " summary\n")
+	for _, s := range all {
+		sep := ""
+		if s.labels != "" {
+			sep = ","
+		}
+		for i, p := range s.percentiles {
+			writeSample(&b, e.name, s.labels+sep+`quantile="`+formatFloat(e.Quantiles[i])+`"`, p)
+		}
+		if sum := float64(s.agg.Sum); sum >= 0 {
+			writeSample(&b, e.name+"_sum", s.labels, sum)
+		}
+		writeSample(&b, e.name+"_count", s.labels, float64(s.agg.Cnt))
+	}
+
+	gauges := []struct {
+		suffix string
+		value  func(agg TypedAggregate[V]) V
+	}{
+		{suffix: "_min", value: func(agg TypedAggregate[V]) V { return agg.Min }},
+		{suffix: "_max", value: func(agg TypedAggregate[V]) V { return agg.Max }},
+		{suffix: "_avg", value: func(agg TypedAggregate[V]) V { return agg.Avg }},
+	}
+	for _, g := range gauges {
+		b.WriteString("# TYPE " + e.name + g.suffix + " gauge\n")
+		for _, s := range all {
+			writeSample(&b, e.name+g.suffix, s.labels, float64(g.value(s.agg)))
+		}
+	}
+
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+
+	return b.Bytes()
+}
+
+// ServeHTTP writes the exposition in the OpenMetrics format if the request
+// accepts it, otherwise in the Prometheus text format.
+func (e *Exporter[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+	w.Write(e.render(openMetrics))
+}
+
+// WriteTo writes the exposition in the OpenMetrics format to w.
+func (e *Exporter[K, V]) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(e.render(true))
+	return int64(n), err
+}
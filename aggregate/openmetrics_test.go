@@ -0,0 +1,144 @@
+package aggregator
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ifaceKey struct {
+	host string
+	name string
+}
+
+func TestExporter_NewExporter_InvalidName(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	assert.Panics(t, func() { NewExporter[string, int64](a, "invalid-name", "", nil) })
+}
+
+func TestExporter_WriteTo(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	for _, value := range []int64{1, 2, 3, 4} {
+		assert.Nil(t, a.Insert("b", value))
+	}
+	assert.Nil(t, a.Insert("a\"\n", -1))
+
+	e := NewExporter[string, int64](a, "latency_ms", "Request\nlatency", nil)
+	e.Quantiles = []float64{0, 1}
+
+	var b bytes.Buffer
+	n, err := e.WriteTo(&b)
+	assert.Equal(t, int64(b.Len()), n)
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP latency_ms Request\nlatency
+# TYPE latency_ms summary
+latency_ms{key="a\"\n",quantile="0"} -1
+latency_ms{key="a\"\n",quantile="1"} -1
+latency_ms_count{key="a\"\n"} 1
+latency_ms{key="b",quantile="0"} 1
+latency_ms{key="b",quantile="1"} 4
+latency_ms_sum{key="b"} 10
+latency_ms_count{key="b"} 4
+# TYPE latency_ms_min gauge
+latency_ms_min{key="a\"\n"} -1
+latency_ms_min{key="b"} 1
+# TYPE latency_ms_max gauge
+latency_ms_max{key="a\"\n"} -1
+latency_ms_max{key="b"} 4
+# TYPE latency_ms_avg gauge
+latency_ms_avg{key="a\"\n"} -1
+latency_ms_avg{key="b"} 2
+# EOF
+`, b.String())
+}
+
+func TestExporter_ServeHTTP(t *testing.T) {
+	a := NewShardedAggregator[ifaceKey, uint64](4)
+	assert.Nil(t, a.Insert(ifaceKey{host: "h1", name: "eth0"}, 1500))
+
+	e := NewExporter[ifaceKey, uint64](a, "rx_bytes", "", func(key ifaceKey) map[string]string {
+		return map[string]string{"interface": key.name, "host": key.host}
+	})
+	e.Quantiles = nil
+
+	expected := `# TYPE rx_bytes summary
+rx_bytes_sum{host="h1",interface="eth0"} 1500
+rx_bytes_count{host="h1",interface="eth0"} 1
+# TYPE rx_bytes_min gauge
+rx_bytes_min{host="h1",interface="eth0"} 1500
+# TYPE rx_bytes_max gauge
+rx_bytes_max{host="h1",interface="eth0"} 1500
+# TYPE rx_bytes_avg gauge
+rx_bytes_avg{host="h1",interface="eth0"} 1500
+`
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, expected, rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, openMetricsContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, expected+"# EOF\n", rec.Body.String())
+}
+
+func TestExporter_Aggregator(t *testing.T) {
+	a := NewAggregator()
+	for _, value := range []int32{1, 2, 3, 4} {
+		assert.Nil(t, a.Insert("a", value))
+	}
+	assert.Nil(t, a.Insert("b", 1500*time.Millisecond))
+	assert.Nil(t, a.Insert("c", complex(1, 1)))
+	assert.Nil(t, a.Insert("d", big.NewInt(1)))
+
+	e := NewExporter(NewAggregatorSource(a), "latency_ms", "", nil)
+	e.Quantiles = []float64{1}
+
+	var b bytes.Buffer
+	_, err := e.WriteTo(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, `# TYPE latency_ms summary
+latency_ms{key="a",quantile="1"} 4
+latency_ms_sum{key="a"} 10
+latency_ms_count{key="a"} 4
+latency_ms{key="b",quantile="1"} 1.5e+09
+latency_ms_sum{key="b"} 1.5e+09
+latency_ms_count{key="b"} 1
+latency_ms_sum{key="d"} 1
+latency_ms_count{key="d"} 1
+# TYPE latency_ms_min gauge
+latency_ms_min{key="a"} 1
+latency_ms_min{key="b"} 1.5e+09
+latency_ms_min{key="d"} 1
+# TYPE latency_ms_max gauge
+latency_ms_max{key="a"} 4
+latency_ms_max{key="b"} 1.5e+09
+latency_ms_max{key="d"} 1
+# TYPE latency_ms_avg gauge
+latency_ms_avg{key="a"} 2
+latency_ms_avg{key="b"} 1.5e+09
+latency_ms_avg{key="d"} 1
+# EOF
+`, b.String())
+}
+
+func TestExporter_InvalidLabelName(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	assert.Nil(t, a.Insert("key", 1))
+
+	for _, name := range []string{"quantile", "invalid-name", "0name", ""} {
+		e := NewExporter[string, int64](a, "latency_ms", "", func(key string) map[string]string {
+			return map[string]string{name: key}
+		})
+		assert.Panics(t, func() { e.WriteTo(io.Discard) }, name)
+	}
+}
@@ -0,0 +1,181 @@
+package aggregator
+
+import (
+	"slices"
+	"time"
+)
+
+// Clock provides the current time to an aggregator.
+type Clock interface {
+	Now() time.Time
+}
+
+// TickerClock is a Clock that also provides tickers. A Reporter of an
+// aggregator whose clock is a TickerClock is scheduled by the clock.
+type TickerClock interface {
+	Clock
+	NewTicker(d time.Duration) (ticks <-chan time.Time, stop func())
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// Option configures an Aggregator or TypedAggregator.
+type Option func(*options)
+
+type options struct {
+	clock        Clock
+	counterBits  int
+	ewmaHalfLife time.Duration
+	histogram    []float64
+	maxKeys      int
+	onEvict      interface{}
+	overflow     OverflowPolicy
+	ttl          time.Duration
+	windowBins   int
+	windowSize   time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithClock sets the clock used to timestamp values passed to Insert, to
+// evaluate windows and rates and to stamp the reports of a Reporter. The
+// default clock is the system clock.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithCounter treats the values of every key as samples of a cumulative
+// counter, such as the byte count of a network interface, that wraps at
+// 2^bits. The first sample of a key sets its baseline and every later sample
+// inserts the increase since the previous sample, so the sum of a key is the
+// total increase, its duration starts at the baseline and GetRate returns the
+// rate of increase. A counter that decreases has wrapped if the increase
+// modulo 2^bits is less than half of the counter range and has otherwise been
+// reset to zero. A key with only a baseline counts toward WithMaxKeys and is
+// evicted by WithTTL like any other key, without calling the eviction
+// callback. Values of custom types are not supported.
+func WithCounter(bits int) Option {
+	if bits != 32 && bits != 64 {
+		panic("counter width must be 32 or 64 bits")
+	}
+
+	return func(o *options) {
+		o.counterBits = bits
+	}
+}
+
+// WithEWMA maintains an exponentially weighted moving average and rate of
+// each key in which the weight of a value halves every halfLife.
+func WithEWMA(halfLife time.Duration) Option {
+	if halfLife <= 0 {
+		panic("half-life must be greater than zero")
+	}
+
+	return func(o *options) {
+		o.ewmaHalfLife = halfLife
+	}
+}
+
+// WithEvictionCallback calls fn with the final aggregate of every key evicted
+// by WithMaxKeys or WithTTL. The callback of an Aggregator must be a
+// func(interface{}, Aggregate, EvictionReason) and the callback of a
+// TypedAggregator[K, V] a func(K, TypedAggregate[V], EvictionReason). The
+// callback is called after the aggregator is unlocked and may use it.
+func WithEvictionCallback[K comparable, A any](fn func(key K, agg A, reason EvictionReason)) Option {
+	if fn == nil {
+		panic("eviction callback must not be nil")
+	}
+
+	return func(o *options) {
+		o.onEvict = fn
+	}
+}
+
+// WithHistogram counts the values of each key in buckets with the given upper
+// bounds, which must be sorted in increasing order.
+func WithHistogram(bounds []float64) Option {
+	if len(bounds) == 0 {
+		panic("histogram requires at least one bound")
+	}
+
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			panic("histogram bounds must be sorted in increasing order")
+		}
+	}
+
+	bounds = slices.Clone(bounds)
+	return func(o *options) {
+		o.histogram = bounds
+	}
+}
+
+// WithMaxKeys limits the number of keys. Inserting a new key into a full
+// aggregator evicts the key that was least recently inserted into. The limit
+// of a ShardedAggregator applies to each shard.
+func WithMaxKeys(n int) Option {
+	if n < 1 {
+		panic("maximum key count must be greater than zero")
+	}
+
+	return func(o *options) {
+		o.maxKeys = n
+	}
+}
+
+// WithOverflowPolicy sets how Insert handles an integer sum that overflows.
+// The default policy is OverflowSaturate.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow = policy
+	}
+}
+
+// WithSlidingWindow aggregates each key over a window of the given size that
+// slides forward in steps of size/buckets.
+func WithSlidingWindow(size time.Duration, buckets int) Option {
+	if buckets < 1 || size < time.Duration(buckets) {
+		panic("window size must be greater than or equal to bucket count")
+	}
+
+	return func(o *options) {
+		o.windowBins = buckets
+		o.windowSize = size
+	}
+}
+
+// WithTTL evicts keys into which no value has been inserted for longer than
+// ttl, as measured from the latest timestamp of the key. Idle keys are evicted
+// as other keys are inserted, or by calling Expire.
+func WithTTL(ttl time.Duration) Option {
+	if ttl <= 0 {
+		panic("ttl must be greater than zero")
+	}
+
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithTumblingWindow aggregates each key over consecutive, non-overlapping
+// windows of the given size.
+func WithTumblingWindow(size time.Duration) Option {
+	return WithSlidingWindow(size, 1)
+}
@@ -0,0 +1,99 @@
+package aggregator
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// OverflowPolicy defines how Insert handles an integer sum that overflows its
+// value type. Floating-point sums follow IEEE 754 and never overflow.
+type OverflowPolicy int
+
+const (
+	// OverflowSaturate clamps the sum to the range of its value type.
+	OverflowSaturate OverflowPolicy = iota
+
+	// OverflowError rejects the value with ErrOverflow and leaves the key
+	// unchanged.
+	OverflowError
+)
+
+func isFloat[V Number]() bool {
+	v := V(1)
+	v /= 2
+	return v != 0
+}
+
+// limits returns the minimum and maximum values of an integer type.
+func limits[V Number]() (V, V) {
+	var lo, hi V
+
+	bitSize := unsafe.Sizeof(lo) * 8
+	if isSigned[V]() {
+		hi = V(uint64(1)<<(bitSize-1) - 1)
+		lo = -hi - 1
+	} else {
+		hi = V(uint64(1)<<bitSize - 1)
+	}
+
+	return lo, hi
+}
+
+// addChecked returns x+y and whether the sum fits in V. If the sum overflows
+// then the saturated sum is returned.
+func addChecked[V Number](x, y V) (V, bool) {
+	sum := x + y
+
+	if !isFloat[V]() {
+		lo, hi := limits[V]()
+		switch {
+		case y > 0 && sum < x:
+			return hi, false
+		case y < 0 && sum > x:
+			return lo, false
+		}
+	}
+
+	return sum, true
+}
+
+func abs64(x int64) (uint64, bool) {
+	if x < 0 {
+		return uint64(-x), true
+	}
+	return uint64(x), false
+}
+
+// mulDiv returns x*y/z for an integer x using a 128-bit intermediate product.
+// It returns ErrOverflow if the quotient does not fit in V.
+func mulDiv[V Number](x V, y, z int64) (V, error) {
+	var ux uint64
+	var nx bool
+
+	if isSigned[V]() {
+		ux, nx = abs64(int64(x))
+	} else {
+		ux = uint64(x)
+	}
+
+	uy, ny := abs64(y)
+	uz, nz := abs64(z)
+	neg := nx != ny != nz
+
+	hi, lo := bits.Mul64(ux, uy)
+	if hi >= uz {
+		return 0, ErrOverflow
+	}
+
+	q, _ := bits.Div64(hi, lo, uz)
+
+	_, max := limits[V]()
+	switch {
+	case neg && q > uint64(max)+1, !neg && q > uint64(max):
+		return 0, ErrOverflow
+	case neg:
+		return -V(q), nil
+	default:
+		return V(q), nil
+	}
+}
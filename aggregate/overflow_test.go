@@ -0,0 +1,78 @@
+package aggregator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	lo8, hi8 := limits[int8]()
+	assert.Equal(t, int8(math.MinInt8), lo8)
+	assert.Equal(t, int8(math.MaxInt8), hi8)
+
+	lo64, hi64 := limits[int64]()
+	assert.Equal(t, int64(math.MinInt64), lo64)
+	assert.Equal(t, int64(math.MaxInt64), hi64)
+
+	ulo16, uhi16 := limits[uint16]()
+	assert.Equal(t, uint16(0), ulo16)
+	assert.Equal(t, uint16(math.MaxUint16), uhi16)
+
+	ulo64, uhi64 := limits[uint64]()
+	assert.Equal(t, uint64(0), ulo64)
+	assert.Equal(t, uint64(math.MaxUint64), uhi64)
+}
+
+func TestAddChecked(t *testing.T) {
+	sum, ok := addChecked[int8](100, 27)
+	assert.Equal(t, int8(127), sum)
+	assert.True(t, ok)
+
+	sum, ok = addChecked[int8](100, 28)
+	assert.Equal(t, int8(math.MaxInt8), sum)
+	assert.False(t, ok)
+
+	sum, ok = addChecked[int8](-100, -29)
+	assert.Equal(t, int8(math.MinInt8), sum)
+	assert.False(t, ok)
+
+	usum, ok := addChecked[uint64](math.MaxUint64-1, 2)
+	assert.Equal(t, uint64(math.MaxUint64), usum)
+	assert.False(t, ok)
+
+	fsum, ok := addChecked[float32](math.MaxFloat32, math.MaxFloat32)
+	assert.True(t, math.IsInf(float64(fsum), 1))
+	assert.True(t, ok)
+}
+
+func TestMulDiv(t *testing.T) {
+	q, err := mulDiv[int64](math.MaxInt64, 1e9, 2e9)
+	assert.Equal(t, int64(math.MaxInt64/2), q)
+	assert.Nil(t, err)
+
+	q, err = mulDiv[int64](math.MinInt64, 1, 1)
+	assert.Equal(t, int64(math.MinInt64), q)
+	assert.Nil(t, err)
+
+	q, err = mulDiv[int64](math.MinInt64, -1, 1)
+	assert.Equal(t, int64(0), q)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	q, err = mulDiv[int64](-7, 2, 4)
+	assert.Equal(t, int64(-3), q)
+	assert.Nil(t, err)
+
+	uq, err := mulDiv[uint64](math.MaxUint64, 5, 4)
+	assert.Equal(t, uint64(0), uq)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	uq, err = mulDiv[uint64](math.MaxUint64, 3, 3)
+	assert.Equal(t, uint64(math.MaxUint64), uq)
+	assert.Nil(t, err)
+
+	bq, err := mulDiv[uint8](200, 2, 1)
+	assert.Equal(t, uint8(0), bq)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
@@ -0,0 +1,171 @@
+package aggregator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+const saveVersion = 1
+
+var saveMagic = []byte("goto/aggregator\x00")
+
+// registeredTypes are the value types that can be decoded from JSON by name.
+var registeredTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, value := range []interface{}{
+		complex64(0), complex128(0), float32(0), float64(0),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+	} {
+		registeredTypes[reflect.TypeOf(value).String()] = reflect.TypeOf(value)
+	}
+
+	RegisterType(time.Duration(0))
+	RegisterType(new(big.Int))
+	RegisterType(Labels{})
+}
+
+// RegisterType registers the type of value so that keys and values of the
+// type can be saved and loaded, and values of the type can be encoded in an
+// AnyState. Named numeric types other than time.Duration and custom Value
+// types must be registered before Save, Load or decoding, and custom types
+// must be encodable by encoding/gob and, for JSON, by encoding/json. Keys of
+// built-in types and Labels need no registration.
+func RegisterType(value interface{}) {
+	gob.Register(value)
+	registeredTypes[reflect.TypeOf(value).String()] = reflect.TypeOf(value)
+}
+
+// savedEntry is the saved form of a key. Exactly one of the states is set.
+type savedEntry struct {
+	Custom *CustomState
+	Float  *State[float64]
+	Int    *State[int64]
+	Key    interface{}
+	Uint   *State[uint64]
+	Value0 interface{}
+}
+
+func (e *entry) save(key interface{}) savedEntry {
+	s := e.state()
+	return savedEntry{Custom: s.Custom, Float: s.Float, Int: s.Int, Key: key, Uint: s.Uint, Value0: s.Value0}
+}
+
+func (a *Aggregator) load(s savedEntry) (*entry, error) {
+	return newEntryFromState(AnyState{Custom: s.Custom, Float: s.Float, Int: s.Int, Uint: s.Uint, Value0: s.Value0}, a.opts)
+}
+
+// Save writes the state of every key, read under a single lock, to w in a
+// versioned binary format. Windows and EWMAs are not saved.
+func (a *Aggregator) Save(w io.Writer) error {
+	a.mu.RLock()
+	entries := make([]savedEntry, 0, len(a.db))
+	for key, e := range a.db {
+		entries = append(entries, e.save(key))
+	}
+	a.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	bw.Write(saveMagic)
+	bw.WriteByte(saveVersion)
+	if err := gob.NewEncoder(bw).Encode(entries); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Load reads keys written by Save and merges them into the aggregator. It
+// returns ErrMalformedState if the data was not written by Save, and nothing
+// is merged unless every key can be decoded. Keys that cannot be merged are
+// skipped and the first error is returned.
+func (a *Aggregator) Load(r io.Reader) error {
+	header := make([]byte, len(saveMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(saveMagic)], saveMagic) || header[len(saveMagic)] != saveVersion {
+		return ErrMalformedState
+	}
+
+	var saved []savedEntry
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedState, err)
+	}
+
+	entries := make(map[interface{}]*entry, len(saved))
+	for _, s := range saved {
+		e, err := a.load(s)
+		if err != nil {
+			return err
+		}
+		entries[s.Key] = e
+	}
+
+	return a.mergeEntries(entries)
+}
+
+// SaveFile saves the aggregator to the file at path. The file is replaced
+// atomically, so it holds either the previous or the new state even if the
+// process crashes while saving.
+func (a *Aggregator) SaveFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = a.Save(f); err == nil {
+		err = f.Sync()
+	}
+
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	return err
+}
+
+// LoadFile loads the aggregator from the file at path written by SaveFile.
+func (a *Aggregator) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return a.Load(bufio.NewReader(f))
+}
+
+// Checkpoint saves the aggregator to the file at path every interval and once
+// more when ctx is done. It returns the error of the first save that fails or
+// else the error of the context.
+func (a *Aggregator) Checkpoint(ctx context.Context, path string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.SaveFile(path); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			if err := a.SaveFile(path); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// persistSteps has a key of every kind of value.
+var persistSteps = []map[interface{}]interface{}{
+	{"float32": float32(0.5), int8(0): int8(0), uint16(0): uint16(0), NewLabels("host", "a"): time.Duration(0), "complex": complex(0, 1), "big": big.NewInt(0)},
+	{"float32": float32(1.5), int8(1): int8(-1), uint16(1): uint16(1), NewLabels("host", "a"): time.Second, "complex": complex(1, 1), "big": big.NewInt(1)},
+	{"float32": float32(2.5), int8(2): int8(-2), uint16(2): uint16(2), NewLabels("host", "a"): 2 * time.Second, "complex": complex(2, 1), "big": big.NewInt(2)},
+}
+
+func TestAggregator_SaveLoad(t *testing.T) {
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+
+	var b bytes.Buffer
+	assert.Nil(t, a.Save(&b))
+
+	d := NewAggregator()
+	assert.Nil(t, d.Load(bytes.NewReader(b.Bytes())))
+	assert.Equal(t, a.Snapshot(), d.Snapshot())
+
+	dur, err := d.GetDuration(NewLabels("host", "a"))
+	assert.Equal(t, 2*time.Second, dur)
+	assert.Nil(t, err)
+
+	p, err := d.GetPercentile(uint16(0), 1)
+	assert.Equal(t, float64(0), p)
+	assert.Nil(t, err)
+
+	// Restored keys keep the type of their first value
+	assert.ErrorIs(t, d.Insert("float32", 1.5), ErrInvalid)
+	assert.Nil(t, d.Insert("float32", float32(1.5)))
+
+	// Loading again merges with the restored keys
+	assert.Nil(t, d.Load(bytes.NewReader(b.Bytes())))
+	agg, err := d.Get("big")
+	assert.Equal(t, Aggregate{Avg: big.NewInt(1), Cnt: int64(6), Max: big.NewInt(2), Min: big.NewInt(0), Sum: big.NewInt(6)}, agg)
+	assert.Nil(t, err)
+}
+
+func TestAggregator_Load_Invalid(t *testing.T) {
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+
+	var b bytes.Buffer
+	assert.Nil(t, a.Save(&b))
+
+	a = NewAggregator()
+	assert.ErrorIs(t, a.Load(bytes.NewReader(nil)), ErrMalformedState)
+	assert.ErrorIs(t, a.Load(bytes.NewReader(b.Bytes()[:len(saveMagic)])), ErrMalformedState)
+	assert.ErrorIs(t, a.Load(bytes.NewReader(b.Bytes()[:b.Len()-1])), ErrMalformedState)
+
+	data := bytes.Clone(b.Bytes())
+	data[len(saveMagic)] = saveVersion + 1
+	assert.ErrorIs(t, a.Load(bytes.NewReader(data)), ErrMalformedState)
+	assert.Equal(t, 0, len(a.Keys()))
+}
+
+func TestAggregator_SaveFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.state")
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+	assert.Nil(t, a.SaveFile(path))
+	assert.Nil(t, a.SaveFile(path))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	d := NewAggregator()
+	assert.Nil(t, d.LoadFile(path))
+	assert.Equal(t, a.Snapshot(), d.Snapshot())
+
+	assert.ErrorIs(t, d.LoadFile(path+".missing"), os.ErrNotExist)
+	assert.NotNil(t, a.SaveFile(filepath.Join(path+".missing", "state")))
+}
+
+func TestAggregator_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.state")
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, a.Checkpoint(ctx, path, time.Hour), context.Canceled)
+
+	d := NewAggregator()
+	assert.Nil(t, d.LoadFile(path))
+	assert.Equal(t, a.Snapshot(), d.Snapshot())
+
+	assert.NotNil(t, a.Checkpoint(context.Background(), filepath.Join(path+".missing", "state"), time.Millisecond))
+}
@@ -0,0 +1,89 @@
+package aggregator
+
+import (
+	"reflect"
+	"sort"
+)
+
+func filter[K comparable, A any](snap map[K]A, pred func(key K, agg A) bool) map[K]A {
+	for key, agg := range snap {
+		if !pred(key, agg) {
+			delete(snap, key)
+		}
+	}
+	return snap
+}
+
+func rangeSnapshot[K comparable, A any](snap map[K]A, fn func(key K, agg A) bool) {
+	for key, agg := range snap {
+		if !fn(key, agg) {
+			break
+		}
+	}
+}
+
+// topN returns up to n keys of snap ordered from greatest to least. Equal
+// keys are returned in unspecified order.
+func topN[K comparable, A any](snap map[K]A, n int, less func(x, y A) bool) []K {
+	top := make([]K, 0, len(snap))
+	for key := range snap {
+		top = append(top, key)
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		return less(snap[top[j]], snap[top[i]])
+	})
+
+	if n < 0 {
+		n = 0
+	}
+	if n < len(top) {
+		top = top[:n]
+	}
+
+	return top
+}
+
+// less reports whether x is less than y, where x and y are values returned by
+// the aggregator. Values of custom types are compared by Less if they have the
+// same type and other numbers by value.
+func (a *Aggregator) less(x, y interface{}) bool {
+	x, errX := convert(x)
+	y, errY := convert(y)
+	if errX != nil || errY != nil {
+		return false
+	}
+
+	if vx, ok := x.(Value); ok {
+		vy, ok := y.(Value)
+		return ok && reflect.TypeOf(vx) == reflect.TypeOf(vy) && vx.Less(vy)
+	}
+
+	switch vx := x.(type) {
+	case int64:
+		if vy, ok := y.(int64); ok {
+			return vx < vy
+		}
+	case uint64:
+		if vy, ok := y.(uint64); ok {
+			return vx < vy
+		}
+	}
+
+	fx, okX := toFloat64(x)
+	fy, okY := toFloat64(y)
+	return okX && okY && fx < fy
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,114 @@
+package aggregator
+
+import (
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator_Keys(t *testing.T) {
+	a := NewAggregator()
+	assert.Equal(t, []interface{}{}, a.Keys())
+
+	assert.Nil(t, a.Insert("a", 1))
+	assert.Nil(t, a.Insert(2, 1.5))
+	assert.ElementsMatch(t, []interface{}{"a", 2}, a.Keys())
+}
+
+func TestAggregator_Range(t *testing.T) {
+	a := NewAggregator()
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, a.Insert(i, uint8(i)))
+	}
+
+	n := 0
+	a.Range(func(key interface{}, agg Aggregate) bool {
+		assert.Equal(t, uint8(key.(int)), agg.Max)
+		assert.Nil(t, a.Delete(key))
+		n++
+		return n < 3
+	})
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 1, len(a.Keys()))
+}
+
+func TestAggregator_Filter(t *testing.T) {
+	a := NewAggregator()
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, a.Insert(i, i))
+	}
+
+	snap := a.Filter(func(key interface{}, agg Aggregate) bool {
+		return agg.Max.(int) > 5
+	})
+	assert.Equal(t, 2, len(snap))
+	assert.Contains(t, snap, 6)
+	assert.Contains(t, snap, 7)
+}
+
+func TestAggregator_TopN(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("int", -3))
+	assert.Nil(t, a.Insert("float", 2.5))
+	assert.Nil(t, a.Insert("uint", uint64(1<<63)))
+	assert.Nil(t, a.Insert("uint", uint64(1<<63)))
+	assert.Nil(t, a.Insert("ten", 10))
+
+	sum := func(agg Aggregate) interface{} { return agg.Sum }
+	assert.Equal(t, []interface{}{"uint", "ten", "float"}, a.TopN(3, sum))
+	assert.Equal(t, []interface{}{}, a.TopN(0, sum))
+	assert.Equal(t, 4, len(a.TopN(10, sum)))
+
+	b := NewAggregator()
+	assert.Nil(t, b.Insert("small", big.NewInt(1)))
+	assert.Nil(t, b.Insert("large", new(big.Int).Lsh(big.NewInt(1), 100)))
+	assert.Equal(t, []interface{}{"large", "small"}, b.TopN(2, func(agg Aggregate) interface{} { return agg.Max }))
+}
+
+func TestTypedAggregator_Query(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	for i, key := range []string{"a", "b", "c", "d"} {
+		assert.Nil(t, a.Insert(key, int64(i)))
+		assert.Nil(t, a.Insert(key, int64(10*i)))
+	}
+
+	keys := a.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, keys)
+
+	assert.Equal(t, []string{"d", "c"}, a.TopN(2, func(agg TypedAggregate[int64]) int64 { return agg.Sum }))
+	assert.Equal(t, []string{"a", "b"}, a.TopN(2, func(agg TypedAggregate[int64]) int64 { return -agg.Max }))
+
+	snap := a.Filter(func(key string, agg TypedAggregate[int64]) bool { return agg.Max > 10 })
+	assert.Equal(t, map[string]TypedAggregate[int64]{
+		"c": {Avg: 11, Cnt: 2, Max: 20, Min: 2, Sum: 22},
+		"d": {Avg: 16, Cnt: 2, Max: 30, Min: 3, Sum: 33},
+	}, snap)
+
+	n := 0
+	a.Range(func(key string, agg TypedAggregate[int64]) bool {
+		n++
+		return true
+	})
+	assert.Equal(t, 4, n)
+}
+
+func TestShardedAggregator_Query(t *testing.T) {
+	a := NewShardedAggregator[int, float64](4)
+	for i := 0; i < 16; i++ {
+		assert.Nil(t, a.Insert(i, float64(i)))
+	}
+
+	assert.Equal(t, 16, len(a.Keys()))
+	assert.Equal(t, []int{15, 14, 13}, a.TopN(3, func(agg TypedAggregate[float64]) float64 { return agg.Sum }))
+	assert.Equal(t, 4, len(a.Filter(func(key int, agg TypedAggregate[float64]) bool { return key%4 == 0 })))
+
+	n := 0
+	a.Range(func(key int, agg TypedAggregate[float64]) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+}
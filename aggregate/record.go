@@ -0,0 +1,367 @@
+package aggregator
+
+import (
+	"math"
+	"time"
+)
+
+// Number is the set of value types that can be aggregated.
+type Number interface {
+	~float32 | ~float64 |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// header holds the state of a record that does not depend on its value type.
+type header struct {
+	count    int64
+	ewma     *ewma
+	lastTime time.Time // Time of the last insert
+	m2       float64
+	mean     float64
+	prevTime time.Time // Time of the insert before the last
+	time0    time.Time
+	timeN    time.Time
+}
+
+func (h *header) head() *header {
+	return h
+}
+
+// getEWMA returns the exponentially weighted moving average of the values.
+func (h *header) getEWMA() (float64, error) {
+	if h.ewma == nil {
+		return 0, ErrNotSupported
+	}
+	return h.ewma.average(), nil
+}
+
+// getEWMARate returns the exponentially weighted rate at time now scaled to
+// the duration dur.
+func (h *header) getEWMARate(now time.Time, dur time.Duration) (float64, error) {
+	if h.ewma == nil {
+		return 0, ErrNotSupported
+	}
+	return h.ewma.rate(now, dur), nil
+}
+
+// stamp extends the time span of the record to include now. Values may be
+// inserted out of order.
+func (h *header) stamp(now time.Time) {
+	if now.Before(h.time0) {
+		h.time0 = now
+	}
+
+	if now.After(h.timeN) {
+		h.timeN = now
+	}
+}
+
+// later returns the later of t and u.
+func later(t, u time.Time) time.Time {
+	if u.After(t) {
+		return u
+	}
+	return t
+}
+
+// update accumulates the running mean and variance of weight values equal to
+// value using Welford's algorithm. The count must already include them.
+func (h *header) update(value float64, weight int64, now time.Time) {
+	delta := value - h.mean
+	h.mean += delta * float64(weight) / float64(h.count)
+	h.m2 += float64(weight) * delta * (value - h.mean)
+
+	if h.ewma != nil {
+		h.ewma.add(value*float64(weight), float64(weight), now)
+	}
+}
+
+// variance returns the population variance of the values.
+func (h *header) variance() float64 {
+	if h.count > 0 {
+		return h.m2 / float64(h.count)
+	}
+	return 0
+}
+
+type record[V Number] struct {
+	header
+	hist   *Histogram
+	last   V // Value of the last insert
+	max    V
+	min    V
+	sketch sketch
+	sum    V
+	window *window[V]
+}
+
+// newRecord creates a record of weight values whose sum is value.
+func newRecord[V Number](value V, weight int64, now time.Time, opts *options) *record[V] {
+	each := float64(value) / float64(weight)
+	r := &record[V]{
+		header: header{count: weight, lastTime: now, mean: each, prevTime: now, time0: now, timeN: now},
+		last:   value,
+		max:    perValue(value, weight),
+		min:    perValue(value, weight),
+		sum:    value,
+	}
+	r.sketch.add(each, uint64(weight))
+
+	if opts.ewmaHalfLife > 0 {
+		r.ewma = newEWMA(opts.ewmaHalfLife, float64(value), float64(weight), now)
+	}
+
+	if opts.histogram != nil {
+		r.hist = newHistogram(opts.histogram)
+		r.hist.add(each, uint64(weight))
+	}
+
+	if opts.windowSize > 0 {
+		r.window = newWindow[V](opts.windowSize, opts.windowBins)
+		r.window.add(value, weight, now)
+	}
+
+	return r
+}
+
+// perValue returns each of weight equal values whose sum is value. Integer
+// values are truncated.
+func perValue[V Number](value V, weight int64) V {
+	if weight == 1 {
+		return value
+	}
+	return V(float64(value) / float64(weight))
+}
+
+func isSigned[V Number]() bool {
+	var v V
+	v--
+	return v < 0
+}
+
+func (r *record[V]) average() V {
+	return averageOf(r.sum, r.count)
+}
+
+func (r *record[V]) aggregate() TypedAggregate[V] {
+	return TypedAggregate[V]{Avg: r.average(), Cnt: r.count, Max: r.max, Min: r.min, Sum: r.sum}
+}
+
+// insert adds weight values whose sum is value to the record.
+func (r *record[V]) insert(value V, weight int64, now time.Time, policy OverflowPolicy) error {
+	sum, ok := addChecked(r.sum, value)
+	if !ok && policy == OverflowError {
+		return ErrOverflow
+	}
+
+	each := perValue(value, weight)
+	r.count += weight
+	r.last = value
+	r.prevTime, r.lastTime = r.lastTime, now
+	r.sum = sum
+	r.stamp(now)
+	r.update(float64(value)/float64(weight), weight, now)
+	r.sketch.add(float64(value)/float64(weight), uint64(weight))
+
+	if r.hist != nil {
+		r.hist.add(float64(value)/float64(weight), uint64(weight))
+	}
+
+	if r.window != nil {
+		r.window.add(value, weight, now)
+	}
+
+	if each < r.min {
+		r.min = each
+	}
+
+	if each > r.max {
+		r.max = each
+	}
+
+	return nil
+}
+
+// getHistogram returns a copy of the histogram of the record.
+func (r *record[V]) getHistogram() (Histogram, error) {
+	if r.hist == nil {
+		return Histogram{}, ErrNotSupported
+	}
+	return r.hist.clone(), nil
+}
+
+// percentile estimates the q-quantile of the inserted values, where q is in
+// [0, 1]. The estimate is clamped to the exact minimum and maximum.
+func (r *record[V]) percentile(q float64) (float64, error) {
+	if !(q >= 0 && q <= 1) {
+		return 0, ErrInvalid
+	}
+
+	p := r.sketch.quantile(q)
+	return math.Max(float64(r.min), math.Min(p, float64(r.max))), nil
+}
+
+func (r *record[V]) rate(dur time.Duration) (V, error) {
+	return rateOf(r.sum, r.timeN.Sub(r.time0), dur)
+}
+
+// rateBetween scales the sum of the record to the duration dur over the
+// interval from start to end. The sum is not split by time, so the interval
+// must contain every inserted value.
+func (r *record[V]) rateBetween(start, end time.Time, dur time.Duration) (V, error) {
+	if r.time0.Before(start) || r.timeN.After(end) {
+		return 0, ErrInvalid
+	}
+	return rateOf(r.sum, end.Sub(start), dur)
+}
+
+// instantRate scales the value of the last insert to the duration dur over
+// the interval since the insert before it. Inserts may be out of order.
+func (r *record[V]) instantRate(dur time.Duration) (V, error) {
+	elapsed := r.lastTime.Sub(r.prevTime)
+	if elapsed < 0 {
+		elapsed = -elapsed
+	}
+	return rateOf(r.last, elapsed, dur)
+}
+
+// getWindow returns the current window, or the previous completed window, of
+// the record at time now.
+func (r *record[V]) getWindow(now time.Time, previous bool) (Window[V], error) {
+	if r.window == nil {
+		return Window[V]{}, ErrNotSupported
+	}
+	return r.window.aggregate(now, previous), nil
+}
+
+// averageOf returns sum divided by count, or sum if count is not positive.
+// The division is done in a 64-bit type because count may not fit in V, so
+// an integer average is zero once count exceeds the maximum of V.
+func averageOf[V Number](sum V, count int64) V {
+	switch {
+	case count < 1:
+		return sum
+	case isFloat[V]():
+		return V(float64(sum) / float64(count))
+	case isSigned[V]():
+		return V(int64(sum) / count)
+	default:
+		return V(uint64(sum) / uint64(count))
+	}
+}
+
+// rateOf scales sum accumulated over elapsed to the duration dur. Integer
+// rates are computed without intermediate overflow and return ErrOverflow if
+// the rate does not fit in V.
+func rateOf[V Number](sum V, elapsed, dur time.Duration) (V, error) {
+	var rate V
+
+	elapsedNsec := elapsed.Nanoseconds()
+	switch {
+	case !isSigned[V]() && (dur < 0 || elapsedNsec < 0):
+		return rate, ErrInvalid
+	case elapsedNsec == 0:
+		return rate, nil
+	case isFloat[V]():
+		return V(float64(sum) * float64(dur.Nanoseconds()) / float64(elapsedNsec)), nil
+	default:
+		return mulDiv(sum, dur.Nanoseconds(), elapsedNsec)
+	}
+}
+
+// anyRecord exposes a record of any value type to the interface{} API.
+type anyRecord interface {
+	head() *header
+	anyAggregate() Aggregate
+	anyAverage() interface{}
+	anyCopy(opts *options) (anyRecord, error)
+	anyInsert(value interface{}, weight int64, now time.Time, policy OverflowPolicy) error
+	anyInstantRate(dur time.Duration) (interface{}, error)
+	anyMax() interface{}
+	anyMerge(other anyRecord, policy OverflowPolicy) error
+	anyMin() interface{}
+	percentile(q float64) (float64, error)
+	anyRate(dur time.Duration) (interface{}, error)
+	anyRateBetween(start, end time.Time, dur time.Duration) (interface{}, error)
+	anySum() interface{}
+	anyVariance() (float64, error)
+	anyWindow(now time.Time, previous bool) (Aggregate, error)
+	getHistogram() (Histogram, error)
+}
+
+func (r *record[V]) anyAggregate() Aggregate {
+	return Aggregate{Avg: r.average(), Cnt: r.count, Max: r.max, Min: r.min, Sum: r.sum}
+}
+
+func (r *record[V]) anyAverage() interface{} {
+	return r.average()
+}
+
+func (r *record[V]) anyCopy(opts *options) (anyRecord, error) {
+	return newRecordFromState(r.state(), opts)
+}
+
+func (r *record[V]) anyInsert(value interface{}, weight int64, now time.Time, policy OverflowPolicy) error {
+	return r.insert(value.(V), weight, now, policy)
+}
+
+func (r *record[V]) anyInstantRate(dur time.Duration) (interface{}, error) {
+	return anyRate(r.instantRate(dur))
+}
+
+func (r *record[V]) anyMax() interface{} {
+	return r.max
+}
+
+func (r *record[V]) anyMerge(other anyRecord, policy OverflowPolicy) error {
+	o := other.(*record[V])
+	lastTime := r.lastTime
+	if err := r.mergeState(o.state(), policy); err != nil {
+		return err
+	}
+
+	if !o.lastTime.Before(lastTime) { // Keep the exact last value of other
+		r.last = o.last
+		r.lastTime = o.lastTime
+		r.prevTime = o.prevTime
+	}
+
+	return nil
+}
+
+func (r *record[V]) anyMin() interface{} {
+	return r.min
+}
+
+func (r *record[V]) anyRate(dur time.Duration) (interface{}, error) {
+	return anyRate(r.rate(dur))
+}
+
+func (r *record[V]) anyRateBetween(start, end time.Time, dur time.Duration) (interface{}, error) {
+	return anyRate(r.rateBetween(start, end, dur))
+}
+
+// anyRate returns a rate as an interface{} that is nil on error.
+func anyRate[V Number](rate V, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (r *record[V]) anySum() interface{} {
+	return r.sum
+}
+
+func (r *record[V]) anyVariance() (float64, error) {
+	return r.variance(), nil
+}
+
+func (r *record[V]) anyWindow(now time.Time, previous bool) (Aggregate, error) {
+	w, err := r.getWindow(now, previous)
+	if err != nil {
+		return Aggregate{}, err
+	}
+	return Aggregate{Avg: w.Average(), Cnt: w.Count, Max: w.Max, Min: w.Min, Sum: w.Sum}, nil
+}
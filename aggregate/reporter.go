@@ -0,0 +1,214 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshotter is an aggregator whose keys can be reported, such as an
+// Aggregator, TypedAggregator or ShardedAggregator. The type A is Aggregate
+// for an Aggregator and TypedAggregate[V] for the typed aggregators.
+type Snapshotter[K comparable, A any] interface {
+	Snapshot() map[K]A
+	SnapshotAndReset() map[K]A
+}
+
+// clocked is implemented by the aggregators of this package, whose reports
+// are stamped and scheduled by the clock set with WithClock.
+type clocked interface {
+	getClock() Clock
+}
+
+// ReportMode selects whether reports are cumulative or deltas.
+type ReportMode int
+
+const (
+	// ReportCumulative reports every value inserted since the reporter was
+	// created and leaves the aggregator unchanged.
+	ReportCumulative ReportMode = iota
+	// ReportDelta reports the values inserted since the previous report and
+	// resets the aggregator.
+	ReportDelta
+)
+
+// Report is the aggregate functions of every key over the interval from Start
+// to End.
+type Report[K comparable, A any] struct {
+	Aggregates map[K]A
+	End        time.Time
+	Start      time.Time
+}
+
+// Sink receives the reports of a Reporter.
+type Sink[K comparable, A any] interface {
+	Emit(ctx context.Context, report Report[K, A]) error
+}
+
+// SinkFunc adapts a callback to a Sink.
+type SinkFunc[K comparable, A any] func(ctx context.Context, report Report[K, A]) error
+
+func (f SinkFunc[K, A]) Emit(ctx context.Context, report Report[K, A]) error {
+	return f(ctx, report)
+}
+
+type channelSink[K comparable, A any] struct {
+	ch chan<- Report[K, A]
+}
+
+// NewChannelSink returns a Sink that sends reports to ch. Emit blocks until
+// the report is received or the context is done.
+func NewChannelSink[K comparable, A any](ch chan<- Report[K, A]) Sink[K, A] {
+	return &channelSink[K, A]{ch: ch}
+}
+
+func (s *channelSink[K, A]) Emit(ctx context.Context, report Report[K, A]) error {
+	select {
+	case s.ch <- report:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type writerSink[K comparable, A any] struct {
+	format func(key K, agg A) string
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// NewWriterSink returns a Sink that writes a line for every key of a report,
+// sorted by line and prefixed with the end time of the report. The format
+// function renders a key and its aggregate functions; if it is nil then they
+// are rendered with fmt.
+func NewWriterSink[K comparable, A any](w io.Writer, format func(key K, agg A) string) Sink[K, A] {
+	if format == nil {
+		format = func(key K, agg A) string {
+			return fmt.Sprintf("%v %+v", key, agg)
+		}
+	}
+
+	return &writerSink[K, A]{format: format, w: w}
+}
+
+func (s *writerSink[K, A]) Emit(ctx context.Context, report Report[K, A]) error {
+	prefix := report.End.Format(time.RFC3339) + " "
+
+	lines := make([]string, 0, len(report.Aggregates))
+	for key, agg := range report.Aggregates {
+		lines = append(lines, prefix+s.format(key, agg)+"\n")
+	}
+	sort.Strings(lines)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := io.WriteString(s.w, strings.Join(lines, ""))
+	return err
+}
+
+// Reporter periodically emits the keys of an aggregator to one or more sinks.
+type Reporter[K comparable, A any] struct {
+	// OnError, if not nil, is called by Run with the error of every report
+	// that fails.
+	OnError func(err error)
+
+	clock    Clock
+	interval time.Duration
+	last     time.Time
+	mode     ReportMode
+	mu       sync.Mutex
+	sinks    []Sink[K, A]
+	source   Snapshotter[K, A]
+}
+
+// NewReporter creates and returns a new Reporter instance that reports the
+// keys of source to sinks every interval. Reports are stamped with the clock
+// of source if it is an aggregator of this package, and with the system clock
+// otherwise. Run is scheduled by that clock if it is a TickerClock.
+func NewReporter[K comparable, A any](source Snapshotter[K, A], interval time.Duration, mode ReportMode, sinks ...Sink[K, A]) *Reporter[K, A] {
+	if interval <= 0 {
+		panic("report interval must be greater than zero")
+	}
+
+	if len(sinks) == 0 {
+		panic("reporter requires at least one sink")
+	}
+
+	var clock Clock = systemClock{}
+	if c, ok := source.(clocked); ok {
+		clock = c.getClock()
+	}
+
+	return &Reporter[K, A]{
+		clock:    clock,
+		interval: interval,
+		last:     clock.Now(),
+		mode:     mode,
+		sinks:    sinks,
+		source:   source,
+	}
+}
+
+// Report emits a report to every sink immediately. Every sink receives the
+// report even if another sink fails, and the errors of all sinks are
+// returned.
+func (r *Reporter[K, A]) Report(ctx context.Context) error {
+	r.mu.Lock()
+	report := Report[K, A]{Start: r.last, End: r.clock.Now()}
+	if r.mode == ReportDelta {
+		report.Aggregates = r.source.SnapshotAndReset()
+		r.last = report.End
+	} else {
+		report.Aggregates = r.source.Snapshot()
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, sink := range r.sinks {
+		if err := sink.Emit(ctx, report); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run emits a report every interval until ctx is done, then emits a final
+// report so that no values are lost, and returns the error of the context.
+// Sinks are given up to one interval to accept the final report.
+func (r *Reporter[K, A]) Run(ctx context.Context) error {
+	var ticks <-chan time.Time
+	if c, ok := r.clock.(TickerClock); ok {
+		var stop func()
+		ticks, stop = c.NewTicker(r.interval)
+		defer stop()
+	} else {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ticks:
+			r.report(ctx)
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.interval)
+			r.report(final)
+			cancel()
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Reporter[K, A]) report(ctx context.Context) {
+	if err := r.Report(ctx); err != nil && r.OnError != nil {
+		r.OnError(err)
+	}
+}
@@ -0,0 +1,118 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporter_Report_Cumulative(t *testing.T) {
+	a := NewAggregator()
+	var reports []Report[interface{}, Aggregate]
+	r := NewReporter[interface{}, Aggregate](a, time.Second, ReportCumulative, SinkFunc[interface{}, Aggregate](func(ctx context.Context, report Report[interface{}, Aggregate]) error {
+		reports = append(reports, report)
+		return nil
+	}))
+
+	assert.Nil(t, a.Insert("key", 1))
+	assert.Nil(t, r.Report(context.Background()))
+	assert.Nil(t, a.Insert("key", 2))
+	assert.Nil(t, r.Report(context.Background()))
+
+	assert.Equal(t, 2, len(reports))
+	assert.Equal(t, int64(1), reports[0].Aggregates["key"].Cnt)
+	assert.Equal(t, int64(2), reports[1].Aggregates["key"].Cnt)
+	assert.Equal(t, reports[0].Start, reports[1].Start)
+	assert.False(t, reports[1].End.Before(reports[1].Start))
+}
+
+func TestReporter_Report_Delta(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	ch := make(chan Report[string, TypedAggregate[int64]], 2)
+	r := NewReporter[string, TypedAggregate[int64]](a, time.Second, ReportDelta, NewChannelSink(ch))
+
+	assert.Nil(t, a.Insert("key", 1))
+	assert.Nil(t, r.Report(context.Background()))
+	assert.Nil(t, a.Insert("key", 2))
+	assert.Nil(t, r.Report(context.Background()))
+
+	first, second := <-ch, <-ch
+	assert.Equal(t, map[string]TypedAggregate[int64]{"key": {Avg: 1, Cnt: 1, Max: 1, Min: 1, Sum: 1}}, first.Aggregates)
+	assert.Equal(t, map[string]TypedAggregate[int64]{"key": {Avg: 2, Cnt: 1, Max: 2, Min: 2, Sum: 2}}, second.Aggregates)
+	assert.Equal(t, first.End, second.Start)
+
+	// A full channel fails when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	full := make(chan Report[string, TypedAggregate[int64]])
+	err := NewReporter[string, TypedAggregate[int64]](a, time.Second, ReportDelta, NewChannelSink(full)).Report(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReporter_Report_Errors(t *testing.T) {
+	errSink := errors.New("sink")
+	n := 0
+	sink := SinkFunc[string, TypedAggregate[float64]](func(ctx context.Context, report Report[string, TypedAggregate[float64]]) error {
+		n++
+		return errSink
+	})
+
+	r := NewReporter[string, TypedAggregate[float64]](NewShardedAggregator[string, float64](2), time.Second, ReportCumulative, sink, sink)
+	assert.ErrorIs(t, r.Report(context.Background()), errSink)
+	assert.Equal(t, 2, n)
+}
+
+func TestReporter_Run(t *testing.T) {
+	clock := &mockClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ticks: make(chan time.Time)}
+	a := NewAggregator(WithClock(clock))
+	assert.Nil(t, a.Insert("key", 1.5))
+
+	var b bytes.Buffer
+	var errs []error
+	r := NewReporter[interface{}, Aggregate](a, time.Second, ReportDelta, NewWriterSink[interface{}, Aggregate](&b, nil), SinkFunc[interface{}, Aggregate](func(ctx context.Context, report Report[interface{}, Aggregate]) error {
+		return errors.New("sink")
+	}))
+	r.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	clock.ticks <- clock.now
+	clock.ticks <- clock.now // The first report is done once the second tick is received
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, "2024-01-02T03:04:05Z key {Avg:1.5 Cnt:1 Max:1.5 Min:1.5 Sum:1.5}\n", b.String())
+	assert.Equal(t, 3, len(errs))
+	assert.Equal(t, 0, len(a.Snapshot()))
+}
+
+func TestWriterSink_Format(t *testing.T) {
+	var b bytes.Buffer
+	sink := NewWriterSink(&b, func(key string, agg TypedAggregate[int64]) string {
+		return key
+	})
+
+	report := Report[string, TypedAggregate[int64]]{
+		Aggregates: map[string]TypedAggregate[int64]{"b": {}, "a": {}},
+		End:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	assert.Nil(t, sink.Emit(context.Background(), report))
+	assert.Equal(t, "2024-01-02T03:04:05Z a\n2024-01-02T03:04:05Z b\n", b.String())
+}
+
+func TestNewReporter_Invalid(t *testing.T) {
+	a := NewAggregator()
+	sink := NewWriterSink[interface{}, Aggregate](&bytes.Buffer{}, nil)
+	assert.Panics(t, func() { NewReporter[interface{}, Aggregate](a, 0, ReportDelta, sink) })
+	assert.Panics(t, func() { NewReporter[interface{}, Aggregate](a, time.Second, ReportDelta) })
+}
@@ -0,0 +1,353 @@
+package aggregator
+
+import (
+	"hash/maphash"
+	"math"
+	"reflect"
+	"time"
+)
+
+var shardSeed = maphash.MakeSeed()
+
+// ShardedAggregator is a TypedAggregator whose keys are hashed into shards
+// that are locked independently, which reduces lock contention when many
+// goroutines insert concurrently. Operations on a single key behave exactly
+// as they do on a TypedAggregator; operations on all keys, such as Snapshot,
+// are consistent within each shard.
+type ShardedAggregator[K comparable, V Number] struct {
+	mask   uint64
+	shards []*TypedAggregator[K, V]
+}
+
+// NewShardedAggregator creates and returns a new ShardedAggregator instance.
+// The number of shards is rounded up to a power of two.
+func NewShardedAggregator[K comparable, V Number](shards int, opts ...Option) *ShardedAggregator[K, V] {
+	if shards < 1 {
+		panic("shard count must be greater than zero")
+	}
+
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+
+	a := &ShardedAggregator[K, V]{
+		mask:   uint64(n - 1),
+		shards: make([]*TypedAggregator[K, V], n),
+	}
+	for i := range a.shards {
+		a.shards[i] = NewTypedAggregator[K, V](opts...)
+	}
+
+	return a
+}
+
+// mix64 is the finalizer of the SplitMix64 generator.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hashKey hashes string, integer and Labels keys directly. Other keys are
+// hashed by hashValue.
+func hashKey[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return maphash.String(shardSeed, k)
+	case int:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	case Labels:
+		return maphash.String(shardSeed, k.s)
+	}
+
+	return hashValue(reflect.ValueOf(key))
+}
+
+// hashValue hashes v so that values that are equal as map keys have equal
+// hashes. Structs and arrays are hashed field by field and element by
+// element, and floating-point zeros are hashed equally regardless of sign.
+func hashValue(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.String:
+		return maphash.String(shardSeed, v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			return mix64(1)
+		}
+		return mix64(0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mix64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mix64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return mix64(hashFloat(real(c)) + hashFloat(imag(c)))
+	case reflect.Chan, reflect.Pointer, reflect.UnsafePointer:
+		return mix64(uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return hashValue(v.Elem())
+	case reflect.Array:
+		var h uint64
+		for i := 0; i < v.Len(); i++ {
+			h = mix64(h + hashValue(v.Index(i)))
+		}
+		return h
+	case reflect.Struct:
+		var h uint64
+		for i := 0; i < v.NumField(); i++ {
+			h = mix64(h + hashValue(v.Field(i)))
+		}
+		return h
+	default:
+		panic("unhashable key type: " + v.Type().String())
+	}
+}
+
+func hashFloat(f float64) uint64 {
+	if f == 0 { // Hash -0 and +0 equally
+		f = 0
+	}
+	return mix64(math.Float64bits(f))
+}
+
+func (a *ShardedAggregator[K, V]) shard(key K) *TypedAggregator[K, V] {
+	return a.shards[hashKey(key)&a.mask]
+}
+
+func (a *ShardedAggregator[K, V]) Delete(key K) error {
+	return a.shard(key).Delete(key)
+}
+
+// Expire evicts every key into which no value has been inserted for longer
+// than the TTL and returns the number of keys evicted.
+func (a *ShardedAggregator[K, V]) Expire() int {
+	n := 0
+	for _, shard := range a.shards {
+		n += shard.Expire()
+	}
+	return n
+}
+
+// Export returns the state of every key. Each shard is read under a single
+// lock.
+func (a *ShardedAggregator[K, V]) Export() map[K]State[V] {
+	states := make(map[K]State[V])
+	for _, shard := range a.shards {
+		for key, s := range shard.Export() {
+			states[key] = s
+		}
+	}
+	return states
+}
+
+// Filter returns the aggregate functions of the keys for which pred returns
+// true. Each shard is read under a single lock and pred may use the
+// aggregator.
+func (a *ShardedAggregator[K, V]) Filter(pred func(key K, agg TypedAggregate[V]) bool) map[K]TypedAggregate[V] {
+	return filter(a.Snapshot(), pred)
+}
+
+func (a *ShardedAggregator[K, V]) Get(key K) (TypedAggregate[V], error) {
+	return a.shard(key).Get(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetAverage(key K) (V, error) {
+	return a.shard(key).GetAverage(key)
+}
+
+func (a *ShardedAggregator[K, V]) getClock() Clock {
+	return a.shards[0].getClock()
+}
+
+func (a *ShardedAggregator[K, V]) GetCount(key K) (int64, error) {
+	return a.shard(key).GetCount(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetDuration(key K) (time.Duration, error) {
+	return a.shard(key).GetDuration(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetEWMA(key K) (float64, error) {
+	return a.shard(key).GetEWMA(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetEWMARate(key K, dur time.Duration) (float64, error) {
+	return a.shard(key).GetEWMARate(key, dur)
+}
+
+func (a *ShardedAggregator[K, V]) GetHistogram(key K) (Histogram, error) {
+	return a.shard(key).GetHistogram(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetInstantRate(key K, dur time.Duration) (V, error) {
+	return a.shard(key).GetInstantRate(key, dur)
+}
+
+func (a *ShardedAggregator[K, V]) GetMaximum(key K) (V, error) {
+	return a.shard(key).GetMaximum(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetMinimum(key K) (V, error) {
+	return a.shard(key).GetMinimum(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetPercentile(key K, q float64) (float64, error) {
+	return a.shard(key).GetPercentile(key, q)
+}
+
+func (a *ShardedAggregator[K, V]) GetPreviousWindow(key K) (Window[V], error) {
+	return a.shard(key).GetPreviousWindow(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetRate(key K, dur time.Duration) (V, error) {
+	return a.shard(key).GetRate(key, dur)
+}
+
+func (a *ShardedAggregator[K, V]) GetRateBetween(key K, start, end time.Time, dur time.Duration) (V, error) {
+	return a.shard(key).GetRateBetween(key, start, end, dur)
+}
+
+func (a *ShardedAggregator[K, V]) GetRateSinceFirst(key K, dur time.Duration) (V, error) {
+	return a.shard(key).GetRateSinceFirst(key, dur)
+}
+
+func (a *ShardedAggregator[K, V]) GetStdDev(key K) (float64, error) {
+	return a.shard(key).GetStdDev(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetSum(key K) (V, error) {
+	return a.shard(key).GetSum(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetVariance(key K) (float64, error) {
+	return a.shard(key).GetVariance(key)
+}
+
+func (a *ShardedAggregator[K, V]) GetWindow(key K) (Window[V], error) {
+	return a.shard(key).GetWindow(key)
+}
+
+func (a *ShardedAggregator[K, V]) Insert(key K, value V) error {
+	return a.shard(key).Insert(key, value)
+}
+
+func (a *ShardedAggregator[K, V]) InsertAt(key K, value V, t time.Time) error {
+	return a.shard(key).InsertAt(key, value, t)
+}
+
+// InsertBatch inserts every sample, taking the lock of each shard once.
+// Samples that cannot be inserted are skipped and the first error is
+// returned.
+func (a *ShardedAggregator[K, V]) InsertBatch(samples []TypedSample[K, V]) error {
+	var err error
+	batches := make([][]TypedSample[K, V], len(a.shards))
+	for _, s := range samples {
+		i := hashKey(s.Key) & a.mask
+		batches[i] = append(batches[i], s)
+	}
+
+	for i, batch := range batches {
+		if len(batch) > 0 {
+			if e := a.shards[i].InsertBatch(batch); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+
+	return err
+}
+
+func (a *ShardedAggregator[K, V]) InsertWeighted(key K, value V, weight int64) error {
+	return a.shard(key).InsertWeighted(key, value, weight)
+}
+
+// Keys returns every key in unspecified order.
+func (a *ShardedAggregator[K, V]) Keys() []K {
+	var keys []K
+	for _, shard := range a.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// Merge merges the state of every key of other into the aggregator. Keys
+// that cannot be merged are skipped and the first error is returned.
+func (a *ShardedAggregator[K, V]) Merge(other *ShardedAggregator[K, V]) error {
+	if other == a {
+		return ErrInvalid
+	}
+
+	var err error
+	for key, s := range other.Export() {
+		if e := a.MergeState(key, s); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func (a *ShardedAggregator[K, V]) MergeState(key K, s State[V]) error {
+	return a.shard(key).MergeState(key, s)
+}
+
+// Range calls fn with the aggregate functions of every key, with each shard
+// read under a single lock, in unspecified order until fn returns false. The
+// function fn may use the aggregator.
+func (a *ShardedAggregator[K, V]) Range(fn func(key K, agg TypedAggregate[V]) bool) {
+	rangeSnapshot(a.Snapshot(), fn)
+}
+
+// Rows returns the row of every key for a Formatter. Each shard is read under
+// a single lock.
+func (a *ShardedAggregator[K, V]) Rows() []Row {
+	var rows []Row
+	for _, shard := range a.shards {
+		rows = append(rows, shard.Rows()...)
+	}
+	return rows
+}
+
+// Snapshot returns the aggregate functions of every key. Each shard is read
+// under a single lock.
+func (a *ShardedAggregator[K, V]) Snapshot() map[K]TypedAggregate[V] {
+	snap := make(map[K]TypedAggregate[V])
+	for _, shard := range a.shards {
+		for key, agg := range shard.Snapshot() {
+			snap[key] = agg
+		}
+	}
+	return snap
+}
+
+// SnapshotAndReset returns the aggregate functions of every key and deletes
+// all keys. Each shard is read and reset atomically.
+func (a *ShardedAggregator[K, V]) SnapshotAndReset() map[K]TypedAggregate[V] {
+	snap := make(map[K]TypedAggregate[V])
+	for _, shard := range a.shards {
+		for key, agg := range shard.SnapshotAndReset() {
+			snap[key] = agg
+		}
+	}
+	return snap
+}
+
+// TopN returns up to n keys with the greatest value(agg) in decreasing order.
+func (a *ShardedAggregator[K, V]) TopN(n int, value func(agg TypedAggregate[V]) V) []K {
+	return topN(a.Snapshot(), n, func(x, y TypedAggregate[V]) bool {
+		return value(x) < value(y)
+	})
+}
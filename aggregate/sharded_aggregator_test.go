@@ -0,0 +1,184 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedAggregator_NewShardedAggregator(t *testing.T) {
+	assert.Panics(t, func() { NewShardedAggregator[string, int64](0) })
+
+	a := NewShardedAggregator[string, int64](5)
+	assert.Equal(t, 8, len(a.shards))
+	assert.Equal(t, uint64(7), a.mask)
+	for _, shard := range a.shards {
+		assert.NotNil(t, shard)
+	}
+}
+
+func TestShardedAggregator_Get(t *testing.T) {
+	a := NewShardedAggregator[int, float64](4, WithSlidingWindow(time.Hour, 60), WithEWMA(time.Hour))
+
+	agg, err := a.Get(0)
+	assert.Equal(t, TypedAggregate[float64]{}, agg)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for i := 0; i < 16; i++ {
+		assert.Nil(t, a.Insert(i, float64(i)))
+		assert.Nil(t, a.Insert(i, float64(i+2)))
+	}
+
+	for i := 0; i < 16; i++ {
+		agg, err = a.Get(i)
+		assert.Equal(t, TypedAggregate[float64]{Avg: float64(i + 1), Cnt: 2, Max: float64(i + 2), Min: float64(i), Sum: float64(2*i + 2)}, agg)
+		assert.Nil(t, err)
+
+		v, err := a.GetVariance(i)
+		assert.Equal(t, float64(1), v)
+		assert.Nil(t, err)
+
+		w, err := a.GetWindow(i)
+		assert.Equal(t, int64(2), w.Count)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, 16, len(a.Snapshot()))
+	assert.Nil(t, a.Delete(0))
+	assert.ErrorIs(t, a.Delete(0), ErrNotFound)
+	assert.Equal(t, 15, len(a.SnapshotAndReset()))
+	assert.Equal(t, 0, len(a.Snapshot()))
+}
+
+func TestShardedAggregator_Merge(t *testing.T) {
+	a1 := NewShardedAggregator[int, uint64](4)
+	a2 := NewShardedAggregator[int, uint64](2)
+	assert.ErrorIs(t, a1.Merge(a1), ErrInvalid)
+
+	for i := 0; i < 16; i++ {
+		assert.Nil(t, a1.Insert(i, uint64(i)))
+		assert.Nil(t, a2.Insert(i, uint64(i+2)))
+	}
+	assert.Nil(t, a1.Merge(a2))
+
+	states := a1.Export()
+	assert.Equal(t, 16, len(states))
+	for i := 0; i < 16; i++ {
+		assert.Equal(t, int64(2), states[i].Count)
+		assert.Equal(t, uint64(2*i+2), states[i].Sum)
+	}
+}
+
+func TestShardedAggregator_Insert_Concurrent(t *testing.T) {
+	a := NewShardedAggregator[string, uint64](8)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				assert.Nil(t, a.Insert(fmt.Sprintf("conn%d", i%10), 1))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		cnt, err := a.GetCount(fmt.Sprintf("conn%d", i))
+		assert.Equal(t, int64(800), cnt)
+		assert.Nil(t, err)
+	}
+}
+
+func TestShardedAggregator_InsertBatch(t *testing.T) {
+	a := NewShardedAggregator[string, uint64](8)
+
+	var samples []TypedSample[string, uint64]
+	for i := 0; i < 100; i++ {
+		samples = append(samples, TypedSample[string, uint64]{Key: fmt.Sprintf("conn%d", i%10), Value: 6, Weight: 3})
+	}
+	assert.Nil(t, a.InsertBatch(samples))
+
+	for i := 0; i < 10; i++ {
+		agg, err := a.Get(fmt.Sprintf("conn%d", i))
+		assert.Equal(t, TypedAggregate[uint64]{Avg: 2, Cnt: 30, Max: 2, Min: 2, Sum: 60}, agg)
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, a.InsertWeighted("conn0", 6, 3))
+	cnt, err := a.GetCount("conn0")
+	assert.Equal(t, int64(33), cnt)
+	assert.Nil(t, err)
+}
+
+func TestHashKey(t *testing.T) {
+	type connKey struct {
+		host string
+		port uint16
+	}
+
+	assert.Equal(t, hashKey("key"), hashKey("key"))
+	assert.Equal(t, hashKey(connKey{"localhost", 80}), hashKey(connKey{"localhost", 80}))
+	assert.NotEqual(t, hashKey(connKey{"localhost", 80}), hashKey(connKey{"localhost", 443}))
+	assert.Equal(t, hashKey(time.Second), hashKey(time.Second))
+	assert.Equal(t, hashKey(math.Copysign(0, -1)), hashKey(float64(0)))
+
+	type pointKey struct {
+		f  float64
+		xy [2]float32
+	}
+	negZero := math.Copysign(0, -1)
+	assert.Equal(t, hashKey(pointKey{f: negZero, xy: [2]float32{float32(negZero), 1}}), hashKey(pointKey{xy: [2]float32{0, 1}}))
+	assert.NotEqual(t, hashKey(pointKey{xy: [2]float32{0, 1}}), hashKey(pointKey{xy: [2]float32{1, 0}}))
+	assert.Equal(t, hashKey(NewLabels("a", "1", "b", "2")), hashKey(NewLabels("b", "2", "a", "1")))
+	assert.Equal(t, hashKey[interface{}](int32(7)), hashKey[interface{}](int32(7)))
+}
+
+func benchmarkInsert(b *testing.B, insert func(key int, value int64) error) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			insert(i%1024, 1)
+			i++
+		}
+	})
+}
+
+func BenchmarkAggregator_Insert(b *testing.B) {
+	a := NewAggregator()
+	benchmarkInsert(b, func(key int, value int64) error { return a.Insert(key, value) })
+}
+
+func BenchmarkTypedAggregator_Insert(b *testing.B) {
+	a := NewTypedAggregator[int, int64]()
+	benchmarkInsert(b, a.Insert)
+}
+
+func BenchmarkShardedAggregator_Insert(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			a := NewShardedAggregator[int, int64](shards)
+			benchmarkInsert(b, a.Insert)
+		})
+	}
+}
+
+func BenchmarkTypedAggregator_InsertBatch(b *testing.B) {
+	a := NewTypedAggregator[int, int64]()
+	b.RunParallel(func(pb *testing.PB) {
+		batch := make([]TypedSample[int, int64], 64)
+		i := 0
+		for pb.Next() {
+			batch[i%len(batch)] = TypedSample[int, int64]{Key: i % 1024, Value: 1}
+			if i++; i%len(batch) == 0 {
+				a.InsertBatch(batch)
+			}
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package aggregator
+
+import (
+	"math"
+)
+
+// The sketch is a DDSketch: values are counted in logarithmically sized
+// buckets so that any quantile is estimated to within a relative error of
+// sketchRelativeAccuracy. Each store is limited to sketchMaxBins buckets,
+// which span about 17.8 orders of magnitude, and the buckets closest to zero
+// are collapsed once that limit is reached, so the error bound only holds for
+// values within that range of the largest magnitude.
+const (
+	sketchMaxBins          = 2048
+	sketchMinValue         = 1e-9
+	sketchRelativeAccuracy = 0.01
+)
+
+var (
+	sketchGamma   = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	sketchLnGamma = math.Log(sketchGamma)
+)
+
+type sketchStore struct {
+	bins   []uint64
+	count  uint64
+	offset int
+}
+
+func (s *sketchStore) add(index int, n uint64) {
+	if len(s.bins) == 0 {
+		s.bins = make([]uint64, 1, 16)
+		s.offset = index
+	}
+
+	if index < s.offset {
+		if hi := s.offset + len(s.bins) - 1; hi-index+1 > sketchMaxBins {
+			index = hi - sketchMaxBins + 1
+		}
+
+		if index < s.offset {
+			bins := make([]uint64, s.offset-index+len(s.bins))
+			copy(bins[s.offset-index:], s.bins)
+			s.bins = bins
+			s.offset = index
+		}
+	} else if index >= s.offset+len(s.bins) {
+		s.bins = append(s.bins, make([]uint64, index-s.offset-len(s.bins)+1)...)
+
+		if n := len(s.bins) - sketchMaxBins; n > 0 {
+			var collapsed uint64
+			for _, c := range s.bins[:n] {
+				collapsed += c
+			}
+
+			copy(s.bins, s.bins[n:])
+			s.bins = s.bins[:sketchMaxBins]
+			s.bins[0] += collapsed
+			s.offset += n
+		}
+	}
+
+	s.bins[index-s.offset] += n
+	s.count += n
+}
+
+type sketch struct {
+	negative sketchStore
+	positive sketchStore
+	zero     uint64
+}
+
+func sketchIndex(value float64) int {
+	return int(math.Ceil(math.Log(value) / sketchLnGamma))
+}
+
+func sketchValue(index int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(index)) / (1 + sketchGamma)
+}
+
+func (s *sketch) count() uint64 {
+	return s.negative.count + s.zero + s.positive.count
+}
+
+// add inserts n values equal to value.
+func (s *sketch) add(value float64, n uint64) {
+	switch {
+	case value >= sketchMinValue:
+		s.positive.add(sketchIndex(value), n)
+	case value <= -sketchMinValue:
+		s.negative.add(sketchIndex(-value), n)
+	default:
+		s.zero += n
+	}
+}
+
+// quantile returns an estimate of the q-quantile, where q is in [0, 1].
+func (s *sketch) quantile(q float64) float64 {
+	count := s.count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(count-1))
+
+	var cum uint64
+	for i := len(s.negative.bins) - 1; i >= 0; i-- {
+		if cum += s.negative.bins[i]; cum > rank {
+			return -sketchValue(s.negative.offset + i)
+		}
+	}
+
+	if cum += s.zero; cum > rank {
+		return 0
+	}
+
+	for i, c := range s.positive.bins {
+		if cum += c; cum > rank {
+			return sketchValue(s.positive.offset + i)
+		}
+	}
+
+	return sketchValue(s.positive.offset + len(s.positive.bins) - 1)
+}
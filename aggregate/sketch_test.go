@@ -0,0 +1,64 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch_Quantile_Empty(t *testing.T) {
+	var s sketch
+	assert.Equal(t, float64(0), s.quantile(0.5))
+}
+
+func TestSketch_Quantile_RelativeError(t *testing.T) {
+	var s sketch
+	for i := 1; i <= 10000; i++ {
+		s.add(float64(i), 1)
+	}
+
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{q: 0, expected: 1},
+		{q: 0.5, expected: 5000},
+		{q: 0.9, expected: 9000},
+		{q: 0.99, expected: 9900},
+		{q: 1, expected: 10000},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("q=%f", test.q), func(t *testing.T) {
+			assert.InEpsilon(t, test.expected, s.quantile(test.q), sketchRelativeAccuracy)
+		})
+	}
+}
+
+func TestSketch_Quantile_SignedValues(t *testing.T) {
+	var s sketch
+	for _, value := range []float64{-100, -10, 0, 10, 100} {
+		s.add(value, 1)
+	}
+
+	assert.InEpsilon(t, -100, s.quantile(0), sketchRelativeAccuracy)
+	assert.InEpsilon(t, -10, s.quantile(0.25), sketchRelativeAccuracy)
+	assert.Equal(t, float64(0), s.quantile(0.5))
+	assert.InEpsilon(t, 10, s.quantile(0.75), sketchRelativeAccuracy)
+	assert.InEpsilon(t, 100, s.quantile(1), sketchRelativeAccuracy)
+}
+
+func TestSketch_Insert_BoundedBins(t *testing.T) {
+	var s sketch
+	for i := 0; i < 600; i++ {
+		s.add(math.Pow(10, float64(i%300)), 1)
+		s.add(-math.Pow(10, float64(-i%9)), 1)
+	}
+
+	assert.Equal(t, sketchMaxBins, len(s.positive.bins))
+	assert.LessOrEqual(t, len(s.negative.bins), sketchMaxBins)
+	assert.Equal(t, uint64(1200), s.count())
+	assert.InEpsilon(t, 1e299, s.quantile(1), sketchRelativeAccuracy)
+}
@@ -0,0 +1,603 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+	"unsafe"
+)
+
+const stateVersion = 1
+
+// SketchState is the serializable state of the quantile sketch of a key.
+type SketchState struct {
+	Negative       []uint64 `json:"negative,omitempty"`
+	NegativeOffset int      `json:"negativeOffset,omitempty"`
+	Positive       []uint64 `json:"positive,omitempty"`
+	PositiveOffset int      `json:"positiveOffset,omitempty"`
+	Zero           uint64   `json:"zero,omitempty"`
+}
+
+// State is the serializable state of a key. A State can be shipped to another
+// process, encoded as JSON or in a compact binary form, and merged into an
+// aggregator without loss. Windows and EWMAs describe the recent activity of
+// a single aggregator and are not part of the state.
+type State[V Number] struct {
+	Count     int64       `json:"count"`
+	Max       V           `json:"max"`
+	Min       V           `json:"min"`
+	Sum       V           `json:"sum"`
+	Time0     time.Time   `json:"time0"`
+	TimeN     time.Time   `json:"timeN"`
+	Mean      float64     `json:"mean"`
+	M2        float64     `json:"m2"`
+	Sketch    SketchState `json:"sketch"`
+	Histogram *Histogram  `json:"histogram,omitempty"`
+}
+
+// AnyState is the serializable state of a key of an Aggregator. Value0 is the
+// first value inserted into the key, whose type is the type of every value of
+// the key, and exactly one of the states is set: Float, Int or Uint for
+// numbers, which are widened as by the Aggregator, or Custom for values of
+// custom types. Like a State, an AnyState can be encoded as JSON or in a
+// binary form and merged into another aggregator without loss. Values of
+// types that need RegisterType to be saved must also be registered to be
+// encoded.
+type AnyState struct {
+	Custom *CustomState    `json:"custom,omitempty"`
+	Float  *State[float64] `json:"float,omitempty"`
+	Int    *State[int64]   `json:"int,omitempty"`
+	Uint   *State[uint64]  `json:"uint,omitempty"`
+	Value0 interface{}     `json:"value0"`
+}
+
+// CustomState is the serializable state of a key with values of a custom
+// type, which are stored as the type of the first value inserted.
+type CustomState struct {
+	Count int64       `json:"count"`
+	Max   interface{} `json:"max"`
+	Min   interface{} `json:"min"`
+	Sum   interface{} `json:"sum"`
+	Time0 time.Time   `json:"time0"`
+	TimeN time.Time   `json:"timeN"`
+}
+
+var (
+	sketchMaxIndex = sketchIndex(math.MaxFloat64)
+	sketchMinIndex = sketchIndex(sketchMinValue)
+)
+
+// valid reports whether the buckets of every store of the state are within
+// the range of the indexes of the sketch and fit in a store.
+func (s SketchState) valid() bool {
+	for _, store := range []struct {
+		bins   []uint64
+		offset int
+	}{{s.Negative, s.NegativeOffset}, {s.Positive, s.PositiveOffset}} {
+		if len(store.bins) > sketchMaxBins || store.offset < sketchMinIndex || store.offset > sketchMaxIndex-len(store.bins)+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// sketchState is a SketchState without its encoding methods.
+type sketchState SketchState
+
+// UnmarshalJSON decodes a sketch state encoded as JSON. It returns
+// ErrMalformedState if the buckets of the state are out of range.
+func (s *SketchState) UnmarshalJSON(data []byte) error {
+	var d sketchState
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+
+	if !SketchState(d).valid() {
+		return ErrMalformedState
+	}
+
+	*s = SketchState(d)
+	return nil
+}
+
+func (s *sketch) merge(state SketchState) {
+	for i, c := range state.Negative {
+		if c > 0 {
+			s.negative.add(state.NegativeOffset+i, c)
+		}
+	}
+
+	for i, c := range state.Positive {
+		if c > 0 {
+			s.positive.add(state.PositiveOffset+i, c)
+		}
+	}
+
+	s.zero += state.Zero
+}
+
+func (s *sketch) state() SketchState {
+	return SketchState{
+		Negative:       slices.Clone(s.negative.bins),
+		NegativeOffset: s.negative.offset,
+		Positive:       slices.Clone(s.positive.bins),
+		PositiveOffset: s.positive.offset,
+		Zero:           s.zero,
+	}
+}
+
+func newRecordFromState[V Number](s State[V], opts *options) (*record[V], error) {
+	r := &record[V]{
+		header: header{time0: s.Time0, timeN: s.TimeN},
+		max:    s.Max,
+		min:    s.Min,
+	}
+
+	if opts.ewmaHalfLife > 0 {
+		r.ewma = &ewma{halfLife: opts.ewmaHalfLife, time: s.TimeN}
+	}
+
+	if opts.histogram != nil {
+		r.hist = newHistogram(opts.histogram)
+	}
+
+	if opts.windowSize > 0 {
+		r.window = newWindow[V](opts.windowSize, opts.windowBins)
+	}
+
+	return r, r.mergeState(s, OverflowSaturate)
+}
+
+// mergeState combines the state s of another aggregator with the record. The
+// histogram of s is ignored unless the record has a histogram.
+func (r *record[V]) mergeState(s State[V], policy OverflowPolicy) error {
+	if s.Count < 1 {
+		return ErrInvalid
+	}
+
+	if !s.Sketch.valid() {
+		return ErrMalformedState
+	}
+
+	if r.hist != nil && s.Histogram != nil && !slices.Equal(r.hist.Bounds, s.Histogram.Bounds) {
+		return ErrBoundsMismatch
+	}
+
+	sum, ok := addChecked(r.sum, s.Sum)
+	if !ok && policy == OverflowError {
+		return ErrOverflow
+	}
+
+	// Combine the running means and variances (Chan et al.)
+	n := r.count + s.Count
+	delta := s.Mean - r.mean
+	r.mean += delta * float64(s.Count) / float64(n)
+	r.m2 += s.M2 + delta*delta*float64(r.count)*float64(s.Count)/float64(n)
+
+	r.count = n
+	r.sum = sum
+	r.max = max(r.max, s.Max)
+	r.min = min(r.min, s.Min)
+	r.stamp(s.Time0)
+	r.stamp(s.TimeN)
+	r.sketch.merge(s.Sketch)
+
+	if r.hist != nil && s.Histogram != nil {
+		r.hist.Merge(*s.Histogram)
+	}
+
+	// A state has no individual values, so its instantaneous rate is its rate
+	// over its whole time span.
+	if !s.TimeN.Before(r.lastTime) {
+		r.last = s.Sum
+		r.lastTime = s.TimeN
+		r.prevTime = s.Time0
+	}
+
+	return nil
+}
+
+func (r *record[V]) state() State[V] {
+	s := State[V]{
+		Count:  r.count,
+		Max:    r.max,
+		Min:    r.min,
+		Sum:    r.sum,
+		Time0:  r.time0,
+		TimeN:  r.timeN,
+		Mean:   r.mean,
+		M2:     r.m2,
+		Sketch: r.sketch.state(),
+	}
+
+	if r.hist != nil {
+		h := r.hist.clone()
+		s.Histogram = &h
+	}
+
+	return s
+}
+
+// typeCode identifies the value type of an encoded state by its kind and size.
+func typeCode[V Number]() byte {
+	var v V
+
+	code := byte(unsafe.Sizeof(v))
+	switch {
+	case isFloat[V]():
+		code |= 0x10
+	case isSigned[V]():
+		code |= 0x20
+	default:
+		code |= 0x30
+	}
+
+	return code
+}
+
+func appendNumber[V Number](b []byte, v V) []byte {
+	switch {
+	case isFloat[V]():
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(float64(v)))
+	case isSigned[V]():
+		return binary.AppendVarint(b, int64(v))
+	default:
+		return binary.AppendUvarint(b, uint64(v))
+	}
+}
+
+func appendBins(b []byte, offset int, bins []uint64) []byte {
+	b = binary.AppendVarint(b, int64(offset))
+	b = binary.AppendUvarint(b, uint64(len(bins)))
+	for _, c := range bins {
+		b = binary.AppendUvarint(b, c)
+	}
+	return b
+}
+
+// MarshalBinary encodes the state in a compact, versioned binary form.
+func (s State[V]) MarshalBinary() ([]byte, error) {
+	b := []byte{stateVersion, typeCode[V]()}
+	b = binary.AppendVarint(b, s.Count)
+	b = appendNumber(b, s.Max)
+	b = appendNumber(b, s.Min)
+	b = appendNumber(b, s.Sum)
+	b = binary.AppendVarint(b, s.Time0.UnixNano())
+	b = binary.AppendVarint(b, s.TimeN.UnixNano())
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(s.Mean))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(s.M2))
+	b = appendBins(b, s.Sketch.NegativeOffset, s.Sketch.Negative)
+	b = appendBins(b, s.Sketch.PositiveOffset, s.Sketch.Positive)
+	b = binary.AppendUvarint(b, s.Sketch.Zero)
+
+	if s.Histogram == nil {
+		b = binary.AppendUvarint(b, 0)
+	} else {
+		b = binary.AppendUvarint(b, uint64(len(s.Histogram.Bounds))+1)
+		for _, bound := range s.Histogram.Bounds {
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(bound))
+		}
+		for _, c := range s.Histogram.Counts {
+			b = binary.AppendUvarint(b, c)
+		}
+	}
+
+	return b, nil
+}
+
+// stateReader decodes a binary state. The first error is sticky.
+type stateReader struct {
+	b   []byte
+	err error
+}
+
+func (r *stateReader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = ErrMalformedState
+		return 0
+	}
+
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *stateReader) float64() float64 {
+	if r.err != nil || len(r.b) < 8 {
+		r.err = ErrMalformedState
+		return 0
+	}
+
+	f := math.Float64frombits(binary.LittleEndian.Uint64(r.b))
+	r.b = r.b[8:]
+	return f
+}
+
+// length reads a slice length that cannot exceed the remaining input.
+func (r *stateReader) length() int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.err = ErrMalformedState
+		return 0
+	}
+	return int(n)
+}
+
+func (r *stateReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = ErrMalformedState
+		return 0
+	}
+
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *stateReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = ErrMalformedState
+		return 0
+	}
+
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *stateReader) bins() (int, []uint64) {
+	offset := int(r.varint())
+
+	var bins []uint64
+	if n := r.length(); n > 0 {
+		bins = make([]uint64, n)
+		for i := range bins {
+			bins[i] = r.uvarint()
+		}
+	}
+
+	return offset, bins
+}
+
+func readNumber[V Number](r *stateReader) V {
+	switch {
+	case isFloat[V]():
+		return V(r.float64())
+	case isSigned[V]():
+		return V(r.varint())
+	default:
+		return V(r.uvarint())
+	}
+}
+
+// UnmarshalBinary decodes a state encoded by MarshalBinary. It returns
+// ErrMalformedState if the data is malformed or was encoded from a different
+// value type.
+func (s *State[V]) UnmarshalBinary(data []byte) error {
+	r := &stateReader{b: data}
+	if r.byte() != stateVersion || r.byte() != typeCode[V]() {
+		return ErrMalformedState
+	}
+
+	var d State[V]
+	d.Count = r.varint()
+	d.Max = readNumber[V](r)
+	d.Min = readNumber[V](r)
+	d.Sum = readNumber[V](r)
+	d.Time0 = time.Unix(0, r.varint())
+	d.TimeN = time.Unix(0, r.varint())
+	d.Mean = r.float64()
+	d.M2 = r.float64()
+	d.Sketch.NegativeOffset, d.Sketch.Negative = r.bins()
+	d.Sketch.PositiveOffset, d.Sketch.Positive = r.bins()
+	d.Sketch.Zero = r.uvarint()
+
+	if n := r.length(); n > 0 {
+		d.Histogram = &Histogram{Bounds: make([]float64, n-1), Counts: make([]uint64, n)}
+		for i := range d.Histogram.Bounds {
+			d.Histogram.Bounds[i] = r.float64()
+		}
+		for i := range d.Histogram.Counts {
+			d.Histogram.Counts[i] = r.uvarint()
+		}
+	}
+
+	if r.err == nil && (len(r.b) > 0 || !d.Sketch.valid()) {
+		r.err = ErrMalformedState
+	}
+
+	if r.err == nil {
+		*s = d
+	}
+
+	return r.err
+}
+
+func (e *entry) state() AnyState {
+	s := AnyState{Value0: e.value0}
+
+	switch r := e.anyRecord.(type) {
+	case *record[float64]:
+		state := r.state()
+		s.Float = &state
+	case *record[int64]:
+		state := r.state()
+		s.Int = &state
+	case *record[uint64]:
+		state := r.state()
+		s.Uint = &state
+	case *customRecord:
+		s.Custom = &CustomState{
+			Count: r.count,
+			Max:   r.anyMax(),
+			Min:   r.anyMin(),
+			Sum:   r.anySum(),
+			Time0: r.time0,
+			TimeN: r.timeN,
+		}
+	}
+
+	return s
+}
+
+// newEntryFromState creates an entry from the state s. It returns
+// ErrMalformedState unless s has the state that matches the type of Value0.
+func newEntryFromState(s AnyState, opts *options) (*entry, error) {
+	value, err := convert(s.Value0)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{value0: s.Value0}
+	switch value.(type) {
+	case float64:
+		if s.Float != nil {
+			e.anyRecord, err = newRecordFromState(*s.Float, opts)
+		}
+	case int64:
+		if s.Int != nil {
+			e.anyRecord, err = newRecordFromState(*s.Int, opts)
+		}
+	case uint64:
+		if s.Uint != nil {
+			e.anyRecord, err = newRecordFromState(*s.Uint, opts)
+		}
+	case Value:
+		if s.Custom != nil {
+			e.anyRecord, err = newCustomRecordFromState(s.Custom, reflect.TypeOf(s.Value0))
+		}
+	}
+
+	if err == nil && e.anyRecord == nil {
+		err = ErrMalformedState
+	}
+
+	return e, err
+}
+
+func newCustomRecordFromState(s *CustomState, typ reflect.Type) (*customRecord, error) {
+	var values [3]Value
+	for i, v := range []interface{}{s.Max, s.Min, s.Sum} {
+		if reflect.TypeOf(v) != typ {
+			return nil, ErrMalformedState
+		}
+
+		f, err := convert(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if values[i], ok = f.(Value); !ok || s.Count < 1 {
+			return nil, ErrMalformedState
+		}
+	}
+
+	return &customRecord{
+		header: header{count: s.Count, time0: s.Time0, timeN: s.TimeN},
+		max:    values[0],
+		min:    values[1],
+		sum:    values[2],
+		typ:    typ,
+	}, nil
+}
+
+// anyState is an AnyState without its encoding methods.
+type anyState AnyState
+
+// MarshalBinary encodes the state in a versioned binary form with
+// encoding/gob.
+func (s AnyState) MarshalBinary() ([]byte, error) {
+	b := bytes.NewBuffer([]byte{stateVersion})
+	if err := gob.NewEncoder(b).Encode(anyState(s)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a state encoded by MarshalBinary. It returns
+// ErrMalformedState if the data is malformed.
+func (s *AnyState) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 || data[0] != stateVersion {
+		return ErrMalformedState
+	}
+
+	var d anyState
+	if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(&d); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedState, err)
+	}
+
+	*s = AnyState(d)
+	return nil
+}
+
+// MarshalJSON encodes the state as JSON with the name of the type of Value0,
+// which is used to decode the values of the state.
+func (s AnyState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		anyState
+		Type string `json:"type"`
+	}{anyState(s), reflect.TypeOf(s.Value0).String()})
+}
+
+// UnmarshalJSON decodes a state encoded by MarshalJSON. It returns
+// ErrMalformedState if the data is malformed or the type of its values is not
+// registered.
+func (s *AnyState) UnmarshalJSON(data []byte) error {
+	var d struct {
+		Custom *struct {
+			Count int64           `json:"count"`
+			Max   json.RawMessage `json:"max"`
+			Min   json.RawMessage `json:"min"`
+			Sum   json.RawMessage `json:"sum"`
+			Time0 time.Time       `json:"time0"`
+			TimeN time.Time       `json:"timeN"`
+		} `json:"custom"`
+		Float  *State[float64] `json:"float"`
+		Int    *State[int64]   `json:"int"`
+		Type   string          `json:"type"`
+		Uint   *State[uint64]  `json:"uint"`
+		Value0 json.RawMessage `json:"value0"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedState, err)
+	}
+
+	typ, ok := registeredTypes[d.Type]
+	if !ok {
+		return fmt.Errorf("%w: unregistered type %q", ErrMalformedState, d.Type)
+	}
+
+	var err error
+	decode := func(data json.RawMessage) interface{} {
+		v := reflect.New(typ)
+		if e := json.Unmarshal(data, v.Interface()); e != nil && err == nil {
+			err = fmt.Errorf("%w: %v", ErrMalformedState, e)
+		}
+		return v.Elem().Interface()
+	}
+
+	state := AnyState{Float: d.Float, Int: d.Int, Uint: d.Uint, Value0: decode(d.Value0)}
+	if c := d.Custom; c != nil {
+		state.Custom = &CustomState{Count: c.Count, Max: decode(c.Max), Min: decode(c.Min), Sum: decode(c.Sum), Time0: c.Time0, TimeN: c.TimeN}
+	}
+
+	if err == nil {
+		*s = state
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestState returns the state of a key with a histogram into which -5, 0,
+// 7 and 20 were inserted one second apart.
+func newTestState(t *testing.T) State[int64] {
+	a := NewTypedAggregator[string, int64](WithHistogram([]float64{0, 10}))
+	insertSteps(t, a.InsertAt, map[string]int64{"key": -5}, map[string]int64{"key": 0}, map[string]int64{"key": 7}, map[string]int64{"key": 20})
+	return a.Export()["key"]
+}
+
+func TestState_MarshalBinary(t *testing.T) {
+	s := newTestState(t)
+	b, err := s.MarshalBinary()
+	assert.Nil(t, err)
+
+	var d State[int64]
+	assert.Nil(t, d.UnmarshalBinary(b))
+	assert.True(t, s.Time0.Equal(d.Time0))
+	assert.True(t, s.TimeN.Equal(d.TimeN))
+	d.Time0, d.TimeN = s.Time0, s.TimeN
+	assert.Equal(t, s, d)
+}
+
+func TestState_MarshalJSON(t *testing.T) {
+	s := newTestState(t)
+	b, err := json.Marshal(s)
+	assert.Nil(t, err)
+
+	var d State[int64]
+	assert.Nil(t, json.Unmarshal(b, &d))
+	assert.True(t, s.Time0.Equal(d.Time0))
+	assert.True(t, s.TimeN.Equal(d.TimeN))
+	d.Time0, d.TimeN = s.Time0, s.TimeN
+	assert.Equal(t, s, d)
+}
+
+func TestState_UnmarshalBinary_Invalid(t *testing.T) {
+	b, err := newTestState(t).MarshalBinary()
+	assert.Nil(t, err)
+
+	var f State[float64]
+	assert.ErrorIs(t, f.UnmarshalBinary(b), ErrMalformedState)
+
+	var s State[int64]
+	assert.ErrorIs(t, s.UnmarshalBinary(nil), ErrMalformedState)
+	assert.ErrorIs(t, s.UnmarshalBinary(b[:len(b)-1]), ErrMalformedState)
+	assert.ErrorIs(t, s.UnmarshalBinary(append(b, 0)), ErrMalformedState)
+	assert.Equal(t, State[int64]{}, s)
+}
+
+func TestRecord_MergeState(t *testing.T) {
+	now := time.Unix(100, 0)
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	all := NewTypedAggregator[int, float64]()
+	parts := []*TypedAggregator[int, float64]{NewTypedAggregator[int, float64](), NewTypedAggregator[int, float64]()}
+	for i, value := range values {
+		assert.Nil(t, all.InsertAt(0, value, now.Add(time.Duration(i)*time.Second)))
+		assert.Nil(t, parts[i%2].InsertAt(0, value, now.Add(time.Duration(i)*time.Second)))
+	}
+
+	assert.Nil(t, parts[0].Merge(parts[1]))
+
+	want, _ := all.Get(0)
+	got, _ := parts[0].Get(0)
+	assert.Equal(t, want, got)
+
+	wantVar, _ := all.GetVariance(0)
+	gotVar, _ := parts[0].GetVariance(0)
+	assert.InDelta(t, wantVar, gotVar, 1e-12)
+
+	dur, _ := parts[0].GetDuration(0)
+	assert.Equal(t, 7*time.Second, dur)
+
+	for _, q := range []float64{0, 0.5, 1} {
+		want, _ := all.GetPercentile(0, q)
+		got, _ := parts[0].GetPercentile(0, q)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestRecord_MergeState_InstantRate(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	assert.Nil(t, a.MergeState("key", newTestState(t)))
+
+	rate, err := a.GetInstantRate("key", 3*time.Second)
+	assert.Equal(t, int64(22), rate)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.InsertAt("key", 30, time.Unix(105, 0)))
+	rate, err = a.GetInstantRate("key", time.Second)
+	assert.Equal(t, int64(15), rate)
+	assert.Nil(t, err)
+}
+
+func TestRecord_MergeState_Invalid(t *testing.T) {
+	r := newRecord[int64](1, 1, time.Now(), &options{histogram: []float64{1}})
+	assert.ErrorIs(t, r.mergeState(State[int64]{}, OverflowSaturate), ErrInvalid)
+	assert.ErrorIs(t, r.mergeState(State[int64]{Count: 1, Histogram: &Histogram{Bounds: []float64{2}, Counts: []uint64{0, 1}}}, OverflowSaturate), ErrBoundsMismatch)
+	assert.ErrorIs(t, r.mergeState(State[int64]{Count: 1, Sum: math.MaxInt64}, OverflowError), ErrOverflow)
+	assert.Equal(t, int64(1), r.count)
+}
+
+func TestState_MalformedSketch(t *testing.T) {
+	for _, sketch := range []SketchState{
+		{Positive: []uint64{1}, PositiveOffset: 1 << 40},
+		{Negative: []uint64{1}, NegativeOffset: sketchMinIndex - 1},
+		{Positive: make([]uint64, sketchMaxBins+1)},
+		{Positive: []uint64{1, 1}, PositiveOffset: sketchMaxIndex},
+	} {
+		s := State[int64]{Count: 1, Sketch: sketch}
+
+		b, err := s.MarshalBinary()
+		assert.Nil(t, err)
+		var d State[int64]
+		assert.ErrorIs(t, d.UnmarshalBinary(b), ErrMalformedState)
+
+		b, err = json.Marshal(s)
+		assert.Nil(t, err)
+		assert.ErrorIs(t, json.Unmarshal(b, &d), ErrMalformedState)
+
+		b, err = AnyState{Int: &s, Value0: int64(0)}.MarshalBinary()
+		assert.Nil(t, err)
+		var u AnyState
+		assert.ErrorIs(t, u.UnmarshalBinary(b), ErrMalformedState)
+
+		r := newRecord[int64](1, 1, time.Now(), &options{})
+		assert.ErrorIs(t, r.mergeState(s, OverflowSaturate), ErrMalformedState)
+		assert.Equal(t, int64(1), r.count)
+
+		a := NewAggregator()
+		assert.ErrorIs(t, a.MergeState("key", AnyState{Int: &s, Value0: int64(0)}), ErrMalformedState)
+	}
+}
+
+func TestAnyState_MarshalBinary(t *testing.T) {
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+
+	d := NewAggregator()
+	for key, s := range a.Export() {
+		b, err := s.MarshalBinary()
+		assert.Nil(t, err)
+
+		var u AnyState
+		assert.Nil(t, u.UnmarshalBinary(b))
+		assert.Nil(t, d.MergeState(key, u))
+	}
+	assert.Equal(t, a.Snapshot(), d.Snapshot())
+
+	var s AnyState
+	assert.ErrorIs(t, s.UnmarshalBinary(nil), ErrMalformedState)
+	assert.ErrorIs(t, s.UnmarshalBinary([]byte{stateVersion, 0}), ErrMalformedState)
+}
+
+func TestAnyState_MarshalJSON(t *testing.T) {
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+	assert.Nil(t, a.Delete("complex")) // Complex values cannot be encoded as JSON
+
+	d := NewAggregator()
+	for key, s := range a.Export() {
+		b, err := json.Marshal(s)
+		assert.Nil(t, err)
+
+		var u AnyState
+		assert.Nil(t, json.Unmarshal(b, &u))
+		assert.Equal(t, s.Value0, u.Value0)
+		assert.Nil(t, d.MergeState(key, u))
+	}
+	assert.Equal(t, a.Snapshot(), d.Snapshot())
+
+	var s AnyState
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"type":"unknown","value0":1}`), &s), ErrMalformedState)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"type":"int32","value0":"1"}`), &s), ErrMalformedState)
+}
+
+func TestAggregator_MergeState(t *testing.T) {
+	a := NewAggregator()
+	insertSteps(t, a.InsertAt, persistSteps...)
+
+	d := NewAggregator()
+	for key, s := range a.Export() {
+		assert.Nil(t, d.MergeState(key, s))
+		assert.Nil(t, d.MergeState(key, s))
+	}
+
+	agg, err := d.Get(uint16(2))
+	assert.Equal(t, Aggregate{Avg: uint64(2), Cnt: int64(2), Max: uint16(2), Min: uint16(2), Sum: uint64(4)}, agg)
+	assert.Nil(t, err)
+
+	agg, err = d.Get("big")
+	assert.Equal(t, Aggregate{Avg: big.NewInt(1), Cnt: int64(6), Max: big.NewInt(2), Min: big.NewInt(0), Sum: big.NewInt(6)}, agg)
+	assert.Nil(t, err)
+
+	// States must match the type of their first value and of the key
+	s := a.Export()["float32"]
+	var mismatch *TypeMismatchError
+	assert.ErrorAs(t, d.MergeState(uint16(2), s), &mismatch)
+	s.Float = nil
+	assert.ErrorIs(t, d.MergeState("new", s), ErrMalformedState)
+	s = a.Export()["big"]
+	s.Custom.Max = int64(2)
+	assert.ErrorIs(t, d.MergeState("new", s), ErrMalformedState)
+	_, err = d.Get("new")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
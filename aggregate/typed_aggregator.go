@@ -0,0 +1,279 @@
+package aggregator
+
+import (
+	"time"
+)
+
+// TypedAggregator aggregates values of a single numeric type V by key. Unlike
+// Aggregator, the sum, minimum and maximum of a key are stored as V and are
+// returned without type assertions.
+type TypedAggregator[K comparable, V Number] struct {
+	*core[K, V, *record[V], TypedAggregate[V]]
+}
+
+// TypedAggregate is a consistent view of the aggregate functions of a key.
+type TypedAggregate[V Number] struct {
+	Avg V
+	Cnt int64
+	Max V
+	Min V
+	Sum V
+}
+
+// TypedSample is a value to insert into a TypedAggregator with InsertBatch.
+// Value is the sum of Weight observations; a Weight of zero is the same as
+// one.
+type TypedSample[K comparable, V Number] struct {
+	Key    K
+	Value  V
+	Weight int64
+}
+
+// NewTypedAggregator creates and returns a new TypedAggregator instance.
+func NewTypedAggregator[K comparable, V Number](opts ...Option) *TypedAggregator[K, V] {
+	create := func(value V, weight int64, now time.Time, opts *options) (*record[V], error) {
+		return newRecord(value, weight, now, opts), nil
+	}
+
+	delta := func(last, next V, bits int) (V, error) {
+		return counterDelta(last, next, bits), nil
+	}
+
+	return &TypedAggregator[K, V]{newCore[K, V, *record[V], TypedAggregate[V]](opts, create, delta)}
+}
+
+// Export returns the state of every key read under a single lock.
+func (a *TypedAggregator[K, V]) Export() map[K]State[V] {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	states := make(map[K]State[V], len(a.db))
+	for key, rec := range a.db {
+		states[key] = rec.state()
+	}
+	return states
+}
+
+func (a *TypedAggregator[K, V]) GetAverage(key K) (V, error) {
+	var avg V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		avg = rec.average()
+	}
+
+	return avg, err
+}
+
+// GetInstantRate returns the value of the last insert of key scaled to the
+// duration dur over the interval since the insert before it. It returns zero
+// if a single value has been inserted.
+func (a *TypedAggregator[K, V]) GetInstantRate(key K, dur time.Duration) (V, error) {
+	var rate V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		rate, err = rec.instantRate(dur)
+	}
+
+	return rate, err
+}
+
+func (a *TypedAggregator[K, V]) GetMaximum(key K) (V, error) {
+	var max V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		max = rec.max
+	}
+
+	return max, err
+}
+
+func (a *TypedAggregator[K, V]) GetMinimum(key K) (V, error) {
+	var min V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		min = rec.min
+	}
+
+	return min, err
+}
+
+// GetPreviousWindow returns the last completed window of key. It returns
+// ErrNotSupported unless the aggregator was created with a window option.
+func (a *TypedAggregator[K, V]) GetPreviousWindow(key K) (Window[V], error) {
+	return a.getWindow(key, true)
+}
+
+func (a *TypedAggregator[K, V]) GetRate(key K, dur time.Duration) (V, error) {
+	var rate V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		rate, err = rec.rate(dur)
+	}
+
+	return rate, err
+}
+
+// GetRateBetween returns the sum of key scaled to the duration dur over the
+// interval from start to end, such as the interval of a report. The sum is
+// not filtered by time, so it returns ErrInvalid unless every value of key
+// was inserted between start and end.
+func (a *TypedAggregator[K, V]) GetRateBetween(key K, start, end time.Time, dur time.Duration) (V, error) {
+	var rate V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		rate, err = rec.rateBetween(start, end, dur)
+	}
+
+	return rate, err
+}
+
+// GetRateSinceFirst returns the sum of key scaled to the duration dur over
+// the interval from the first value inserted to now, or to the last value
+// inserted if it is later, so the rate of a key decays while no values are
+// inserted.
+func (a *TypedAggregator[K, V]) GetRateSinceFirst(key K, dur time.Duration) (V, error) {
+	var rate V
+	now := a.opts.clock.Now()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		rate, err = rec.rateBetween(rec.time0, later(now, rec.timeN), dur)
+	}
+
+	return rate, err
+}
+
+func (a *TypedAggregator[K, V]) GetSum(key K) (V, error) {
+	var sum V
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		sum = rec.sum
+	}
+
+	return sum, err
+}
+
+// GetWindow returns the window of key that ends now. It returns
+// ErrNotSupported unless the aggregator was created with a window option.
+func (a *TypedAggregator[K, V]) GetWindow(key K) (Window[V], error) {
+	return a.getWindow(key, false)
+}
+
+func (a *TypedAggregator[K, V]) getWindow(key K, previous bool) (Window[V], error) {
+	var w Window[V]
+	now := a.opts.clock.Now()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rec, err := a.findRecord(key)
+	if err == nil {
+		w, err = rec.getWindow(now, previous)
+	}
+
+	return w, err
+}
+
+// InsertBatch inserts every sample under a single lock with the same
+// timestamp. Samples that cannot be inserted are skipped and the first error
+// is returned.
+func (a *TypedAggregator[K, V]) InsertBatch(samples []TypedSample[K, V]) error {
+	return a.insertBatch(len(samples), func(i int) (K, V, int64) {
+		return samples[i].Key, samples[i].Value, samples[i].Weight
+	})
+}
+
+// Merge merges the state of every key of other into the aggregator. Keys
+// that cannot be merged are skipped and the first error is returned.
+func (a *TypedAggregator[K, V]) Merge(other *TypedAggregator[K, V]) error {
+	if other == a {
+		return ErrInvalid
+	}
+
+	states := other.Export()
+
+	a.mu.Lock()
+	var err error
+	for key, s := range states {
+		if e := a.mergeState(key, s); e != nil && err == nil {
+			err = e
+		}
+	}
+	evicted := a.evict(false)
+	a.mu.Unlock()
+
+	a.evictor.notify(evicted)
+	return err
+}
+
+// MergeState merges the state s of key, exported from another aggregator,
+// into the aggregator.
+func (a *TypedAggregator[K, V]) MergeState(key K, s State[V]) error {
+	a.mu.Lock()
+	err := a.mergeState(key, s)
+	evicted := a.evict(false)
+	a.mu.Unlock()
+
+	a.evictor.notify(evicted)
+	return err
+}
+
+func (a *TypedAggregator[K, V]) mergeState(key K, s State[V]) error {
+	rec, ok := a.db[key]
+	var err error
+	if ok {
+		err = rec.mergeState(s, a.opts.overflow)
+	} else if rec, err = newRecordFromState(s, a.opts); err == nil {
+		a.db[key] = rec
+	}
+
+	if err == nil {
+		a.evictor.touch(key)
+	}
+
+	return err
+}
+
+// Rows returns the row of every key for a Formatter, read under a single lock.
+func (a *TypedAggregator[K, V]) Rows() []Row {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rows := make([]Row, 0, len(a.db))
+	for key, rec := range a.db {
+		rows = append(rows, NewTypedRow(key, rec.aggregate(), rec.timeN.Sub(rec.time0)))
+	}
+	return rows
+}
+
+// TopN returns up to n keys with the greatest value(agg) in decreasing order.
+// For example, value may return the sum of a key to find the keys with the
+// greatest sums.
+func (a *TypedAggregator[K, V]) TopN(n int, value func(agg TypedAggregate[V]) V) []K {
+	return topN(a.Snapshot(), n, func(x, y TypedAggregate[V]) bool {
+		return value(x) < value(y)
+	})
+}
@@ -0,0 +1,560 @@
+package aggregator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockClock struct {
+	now   time.Time
+	ticks chan time.Time
+}
+
+func (c *mockClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	return c.ticks, func() {}
+}
+
+func (c *mockClock) Now() time.Time {
+	return c.now
+}
+
+// insertSteps inserts the values of every step one second after the previous
+// step, starting at time.Unix(100, 0).
+func insertSteps[K comparable, V any](t *testing.T, insertAt func(key K, value V, t time.Time) error, steps ...map[K]V) {
+	for i, step := range steps {
+		for key, value := range step {
+			assert.Nil(t, insertAt(key, value, time.Unix(100+int64(i), 0)))
+		}
+	}
+}
+
+func TestTypedAggregator_Delete(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	assert.ErrorIs(t, a.Delete("invalid"), ErrNotFound)
+
+	assert.Nil(t, a.Insert("key", 1))
+	assert.Nil(t, a.Delete("key"))
+	assert.ErrorIs(t, a.Delete("key"), ErrNotFound)
+}
+
+func TestTypedAggregator_Get(t *testing.T) {
+	a := NewTypedAggregator[string, float64]()
+	agg, err := a.Get("invalid")
+	assert.Equal(t, TypedAggregate[float64]{}, agg)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, a.Insert("key", 1.5))
+	assert.Nil(t, a.Insert("key", 2.5))
+
+	agg, err = a.Get("key")
+	assert.Equal(t, TypedAggregate[float64]{Avg: 2, Cnt: 2, Max: 2.5, Min: 1.5, Sum: 4}, agg)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetAverage_SmallTypes(t *testing.T) {
+	// Counts beyond the range of the value type do not wrap
+	u := NewTypedAggregator[string, uint8]()
+	assert.Nil(t, u.InsertWeighted("key", 0, 256))
+	assert.Nil(t, u.Insert("key", 100))
+
+	agg, err := u.Get("key")
+	assert.Equal(t, TypedAggregate[uint8]{Avg: 0, Cnt: 257, Max: 100, Min: 0, Sum: 100}, agg)
+	assert.Nil(t, err)
+
+	i := NewTypedAggregator[string, int16]()
+	assert.Nil(t, i.InsertWeighted("key", 0, 1<<16))
+	assert.Nil(t, i.Insert("key", -100))
+
+	avg, err := i.GetAverage("key")
+	assert.Equal(t, int16(0), avg)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_Get_InvalidKey(t *testing.T) {
+	a := NewTypedAggregator[string, float64]()
+
+	avg, err := a.GetAverage("invalid")
+	assert.Equal(t, float64(0), avg)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	cnt, err := a.GetCount("invalid")
+	assert.Equal(t, int64(-1), cnt)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	dur, err := a.GetDuration("invalid")
+	assert.Equal(t, time.Duration(0), dur)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	max, err := a.GetMaximum("invalid")
+	assert.Equal(t, float64(0), max)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	min, err := a.GetMinimum("invalid")
+	assert.Equal(t, float64(0), min)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	rate, err := a.GetRate("invalid", time.Second)
+	assert.Equal(t, float64(0), rate)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	sum, err := a.GetSum("invalid")
+	assert.Equal(t, float64(0), sum)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTypedAggregator_Get_ValidKey(t *testing.T) {
+	a := NewTypedAggregator[int, int32]()
+	for _, value := range []int32{-2, 1, 7} {
+		assert.Nil(t, a.Insert(0, value))
+	}
+
+	avg, err := a.GetAverage(0)
+	assert.Equal(t, int32(2), avg)
+	assert.Nil(t, err)
+
+	cnt, err := a.GetCount(0)
+	assert.Equal(t, int64(3), cnt)
+	assert.Nil(t, err)
+
+	max, err := a.GetMaximum(0)
+	assert.Equal(t, int32(7), max)
+	assert.Nil(t, err)
+
+	min, err := a.GetMinimum(0)
+	assert.Equal(t, int32(-2), min)
+	assert.Nil(t, err)
+
+	sum, err := a.GetSum(0)
+	assert.Equal(t, int32(6), sum)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetRate(t *testing.T) {
+	f := NewTypedAggregator[string, float32]()
+	i := NewTypedAggregator[string, int64]()
+	u := NewTypedAggregator[string, uint64]()
+
+	for n := 0; n < 2; n++ {
+		assert.Nil(t, f.Insert("key", 1))
+		assert.Nil(t, i.Insert("key", 1))
+		assert.Nil(t, u.Insert("key", 1))
+	}
+
+	// Mock the elapsed time
+	f.db["key"].timeN = f.db["key"].time0.Add(time.Millisecond * 500)
+	i.db["key"].timeN = i.db["key"].time0.Add(time.Millisecond * 500)
+	u.db["key"].timeN = u.db["key"].time0.Add(time.Millisecond * 500)
+
+	fRate, err := f.GetRate("key", -time.Second)
+	assert.Equal(t, float32(-4), fRate)
+	assert.Nil(t, err)
+
+	iRate, err := i.GetRate("key", -time.Second)
+	assert.Equal(t, int64(-4), iRate)
+	assert.Nil(t, err)
+
+	uRate, err := u.GetRate("key", -time.Second)
+	assert.Equal(t, uint64(0), uRate)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	uRate, err = u.GetRate("key", time.Second)
+	assert.Equal(t, uint64(4), uRate)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetRate_Overflow(t *testing.T) {
+	a := NewTypedAggregator[string, uint64]()
+	assert.Nil(t, a.Insert("bytes", math.MaxUint64/2))
+	assert.Nil(t, a.Insert("bytes", math.MaxUint64/2))
+	a.db["bytes"].timeN = a.db["bytes"].time0.Add(10 * time.Second) // Mock the elapsed time
+
+	rate, err := a.GetRate("bytes", time.Second)
+	assert.Equal(t, uint64(math.MaxUint64/10), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetRate("bytes", time.Minute)
+	assert.Equal(t, uint64(0), rate)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestTypedAggregator_GetRate_Variants(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	clock := &mockClock{now: t0}
+	a := NewTypedAggregator[string, uint64](WithClock(clock))
+
+	_, err := a.GetInstantRate("key", time.Second)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, a.Insert("key", 100))
+	rate, err := a.GetInstantRate("key", time.Second)
+	assert.Equal(t, uint64(0), rate)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.InsertAt("key", 200, t0.Add(time.Second)))
+	assert.Nil(t, a.InsertAt("key", 50, t0.Add(3*time.Second)))
+	clock.now = t0.Add(7 * time.Second)
+
+	rate, err = a.GetRate("key", time.Second)
+	assert.Equal(t, uint64(116), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetInstantRate("key", time.Second)
+	assert.Equal(t, uint64(25), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetRateSinceFirst("key", time.Second)
+	assert.Equal(t, uint64(50), rate)
+	assert.Nil(t, err)
+
+	rate, err = a.GetRateBetween("key", t0.Add(-3*time.Second), t0.Add(7*time.Second), time.Second)
+	assert.Equal(t, uint64(35), rate)
+	assert.Nil(t, err)
+
+	_, err = a.GetRateBetween("key", t0, t0.Add(-time.Second), time.Second)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = a.GetRateBetween("key", t0.Add(time.Second), t0.Add(7*time.Second), time.Second)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = a.GetRateBetween("key", t0, t0.Add(2*time.Second), time.Second)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	clock.now = t0.Add(time.Second) // Before the last value
+	rate, err = a.GetRateSinceFirst("key", time.Second)
+	assert.Equal(t, uint64(116), rate)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.InsertAt("key", 40, t0.Add(time.Second)))
+	rate, err = a.GetInstantRate("key", time.Second)
+	assert.Equal(t, uint64(20), rate)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetInstantRate_Counter(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	a := NewTypedAggregator[string, uint64](WithCounter(64))
+
+	assert.Nil(t, a.InsertAt("rx", 1000, t0))
+	assert.Nil(t, a.InsertAt("rx", 1600, t0.Add(2*time.Second)))
+
+	rate, err := a.GetInstantRate("rx", time.Second)
+	assert.Equal(t, uint64(300), rate)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_InsertAt(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	a := NewTypedAggregator[string, uint64]()
+
+	assert.Nil(t, a.InsertAt("key", 100, t0.Add(2*time.Second)))
+	assert.Nil(t, a.InsertAt("key", 100, t0))
+	assert.Nil(t, a.InsertAt("key", 100, t0.Add(4*time.Second)))
+	assert.Nil(t, a.InsertAt("key", 100, t0.Add(time.Second)))
+
+	dur, err := a.GetDuration("key")
+	assert.Equal(t, 4*time.Second, dur)
+	assert.Nil(t, err)
+
+	rate, err := a.GetRate("key", time.Second)
+	assert.Equal(t, uint64(100), rate)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_InsertBatch(t *testing.T) {
+	clock := &mockClock{now: time.Unix(1700000000, 0)}
+	a := NewTypedAggregator[string, uint64](WithClock(clock))
+
+	assert.ErrorIs(t, a.InsertBatch([]TypedSample[string, uint64]{
+		{Key: "a", Value: 1},
+		{Key: "b", Value: 10, Weight: 5},
+		{Key: "c", Value: 1, Weight: -1},
+		{Key: "a", Value: 3},
+	}), ErrInvalid)
+
+	agg, err := a.Get("a")
+	assert.Equal(t, TypedAggregate[uint64]{Avg: 2, Cnt: 2, Max: 3, Min: 1, Sum: 4}, agg)
+	assert.Nil(t, err)
+
+	agg, err = a.Get("b")
+	assert.Equal(t, TypedAggregate[uint64]{Avg: 2, Cnt: 5, Max: 2, Min: 2, Sum: 10}, agg)
+	assert.Nil(t, err)
+
+	_, err = a.Get("c")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, a.InsertBatch(nil))
+}
+
+func TestTypedAggregator_InsertWeighted(t *testing.T) {
+	a := NewTypedAggregator[string, float64](WithHistogram([]float64{200}), WithTumblingWindow(time.Hour))
+
+	assert.Nil(t, a.InsertWeighted("pkt", 1000, 10))
+	assert.Nil(t, a.Insert("pkt", 400))
+	assert.ErrorIs(t, a.InsertWeighted("pkt", 1, 0), ErrInvalid)
+
+	agg, err := a.Get("pkt")
+	assert.Equal(t, TypedAggregate[float64]{Avg: 1400.0 / 11, Cnt: 11, Max: 400, Min: 100, Sum: 1400}, agg)
+	assert.Nil(t, err)
+
+	mean := 1400.0 / 11
+	variance, err := a.GetVariance("pkt")
+	assert.InDelta(t, (10*(100-mean)*(100-mean)+(400-mean)*(400-mean))/11, variance, 1e-9)
+	assert.Nil(t, err)
+
+	p, err := a.GetPercentile("pkt", 0.5)
+	assert.InDelta(t, 100, p, 2)
+	assert.Nil(t, err)
+
+	hist, err := a.GetHistogram("pkt")
+	assert.Equal(t, []uint64{10, 1}, hist.Counts)
+	assert.Nil(t, err)
+
+	w, err := a.GetWindow("pkt")
+	assert.Equal(t, int64(11), w.Count)
+	assert.Equal(t, float64(100), w.Min)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_WithClock(t *testing.T) {
+	clock := &mockClock{now: time.Unix(1700000000, 0)}
+	a := NewTypedAggregator[string, int64](WithClock(clock), WithTumblingWindow(time.Second))
+
+	assert.Nil(t, a.Insert("key", 1))
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	assert.Nil(t, a.Insert("key", 2))
+	clock.now = clock.now.Add(time.Second)
+	assert.Nil(t, a.Insert("key", 4))
+
+	dur, err := a.GetDuration("key")
+	assert.Equal(t, 1500*time.Millisecond, dur)
+	assert.Nil(t, err)
+
+	w, err := a.GetWindow("key")
+	assert.Equal(t, Window[int64]{Start: time.Unix(1700000001, 0), End: clock.now, Count: 1, Max: 4, Min: 4, Sum: 4}, w)
+	assert.Nil(t, err)
+
+	w, err = a.GetPreviousWindow("key")
+	assert.Equal(t, Window[int64]{Start: time.Unix(1700000000, 0), End: time.Unix(1700000001, 0), Count: 2, Max: 2, Min: 1, Sum: 3}, w)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_Insert_Overflow(t *testing.T) {
+	a := NewTypedAggregator[string, int16]()
+	assert.Nil(t, a.Insert("key", math.MaxInt16))
+	assert.Nil(t, a.Insert("key", 1))
+
+	sum, err := a.GetSum("key")
+	assert.Equal(t, int16(math.MaxInt16), sum)
+	assert.Nil(t, err)
+
+	a = NewTypedAggregator[string, int16](WithOverflowPolicy(OverflowError))
+	assert.Nil(t, a.Insert("key", math.MinInt16))
+	assert.ErrorIs(t, a.Insert("key", -1), ErrOverflow)
+	assert.Nil(t, a.Insert("key", 1))
+
+	agg, err := a.Get("key")
+	assert.Equal(t, TypedAggregate[int16]{Avg: (math.MinInt16 + 1) / 2, Cnt: 2, Max: 1, Min: math.MinInt16, Sum: math.MinInt16 + 1}, agg)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_Merge(t *testing.T) {
+	bounds := []float64{1, 2}
+	a1 := NewTypedAggregator[string, int32](WithHistogram(bounds))
+	a2 := NewTypedAggregator[string, int32](WithHistogram(bounds))
+	assert.ErrorIs(t, a1.Merge(a1), ErrInvalid)
+
+	assert.Nil(t, a1.Insert("both", 1))
+	assert.Nil(t, a2.Insert("both", 3))
+	assert.Nil(t, a2.Insert("other", 2))
+	assert.Nil(t, a1.Merge(a2))
+
+	agg, err := a1.Get("both")
+	assert.Equal(t, TypedAggregate[int32]{Avg: 2, Cnt: 2, Max: 3, Min: 1, Sum: 4}, agg)
+	assert.Nil(t, err)
+
+	h, err := a1.GetHistogram("both")
+	assert.Equal(t, []uint64{1, 0, 1}, h.Counts)
+	assert.Nil(t, err)
+
+	agg, err = a1.Get("other")
+	assert.Equal(t, TypedAggregate[int32]{Avg: 2, Cnt: 1, Max: 2, Min: 2, Sum: 2}, agg)
+	assert.Nil(t, err)
+
+	assert.ErrorIs(t, a1.MergeState("both", State[int32]{}), ErrInvalid)
+
+	a3 := NewTypedAggregator[string, int32](WithOverflowPolicy(OverflowError))
+	assert.Nil(t, a3.Insert("both", math.MaxInt32))
+	assert.ErrorIs(t, a3.Merge(a2), ErrOverflow)
+	assert.Equal(t, int64(1), mustGetCount(t, a3, "both"))
+}
+
+func mustGetCount[K comparable, V Number](t *testing.T, a *TypedAggregator[K, V], key K) int64 {
+	cnt, err := a.GetCount(key)
+	assert.Nil(t, err)
+	return cnt
+}
+
+func TestTypedAggregator_NewTypedAggregator(t *testing.T) {
+	a := NewTypedAggregator[string, uint64]()
+
+	assert.NotNil(t, a)
+	assert.NotNil(t, a.db)
+	assert.Equal(t, 0, len(a.db))
+	assert.NotNil(t, a.mu)
+}
+
+func TestTypedAggregator_GetEWMA(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	assert.Nil(t, a.Insert("key", 1))
+
+	_, err := a.GetEWMA("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetEWMARate("key", time.Second)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	a = NewTypedAggregator[string, int64](WithEWMA(time.Hour))
+	_, err = a.GetEWMA("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, a.Insert("key", 10))
+	assert.Nil(t, a.Insert("key", 20))
+
+	avg, err := a.GetEWMA("key")
+	assert.InDelta(t, float64(15), avg, 0.01)
+	assert.Nil(t, err)
+
+	rate, err := a.GetEWMARate("key", time.Hour)
+	assert.InDelta(t, float64(30*math.Ln2), rate, 0.01)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetHistogram(t *testing.T) {
+	a := NewTypedAggregator[string, time.Duration]()
+	assert.Nil(t, a.Insert("key", time.Millisecond))
+
+	_, err := a.GetHistogram("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	bounds := ExponentialBuckets(float64(time.Millisecond), 10, 3)
+	a1 := NewTypedAggregator[string, time.Duration](WithHistogram(bounds))
+	a2 := NewTypedAggregator[string, time.Duration](WithHistogram(bounds))
+
+	_, err = a1.GetHistogram("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, d := range []time.Duration{time.Millisecond, 5 * time.Millisecond, time.Second} {
+		assert.Nil(t, a1.Insert("key", d))
+		assert.Nil(t, a2.Insert("key", 2*d))
+	}
+
+	h1, err := a1.GetHistogram("key")
+	assert.Equal(t, Histogram{Bounds: bounds, Counts: []uint64{1, 1, 0, 1}}, h1)
+	assert.Nil(t, err)
+
+	h2, err := a2.GetHistogram("key")
+	assert.Equal(t, Histogram{Bounds: bounds, Counts: []uint64{0, 2, 0, 1}}, h2)
+	assert.Nil(t, err)
+
+	assert.Nil(t, h1.Merge(h2))
+	assert.Equal(t, []uint64{1, 3, 0, 2}, h1.Counts)
+
+	// The histogram of the aggregator is not modified by the merge
+	h1, err = a1.GetHistogram("key")
+	assert.Equal(t, []uint64{1, 1, 0, 1}, h1.Counts)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetPercentile(t *testing.T) {
+	a := NewTypedAggregator[string, time.Duration]()
+	for i := 1; i <= 1000; i++ {
+		assert.Nil(t, a.Insert("latency", time.Duration(i)*time.Millisecond))
+	}
+
+	p, err := a.GetPercentile("invalid", 0.5)
+	assert.Equal(t, float64(0), p)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	p, err = a.GetPercentile("latency", 1.5)
+	assert.Equal(t, float64(0), p)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	p, err = a.GetPercentile("latency", 0)
+	assert.Equal(t, float64(time.Millisecond), p)
+	assert.Nil(t, err)
+
+	p, err = a.GetPercentile("latency", 0.99)
+	assert.InEpsilon(t, float64(990*time.Millisecond), p, 0.01)
+	assert.Nil(t, err)
+
+	p, err = a.GetPercentile("latency", 1)
+	assert.Equal(t, float64(time.Second), p)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetVariance(t *testing.T) {
+	a := NewTypedAggregator[string, float64]()
+	_, err := a.GetVariance("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = a.GetStdDev("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, value := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		assert.Nil(t, a.Insert("key", value))
+	}
+
+	v, err := a.GetVariance("key")
+	assert.InDelta(t, float64(4), v, 1e-9)
+	assert.Nil(t, err)
+
+	sd, err := a.GetStdDev("key")
+	assert.InDelta(t, float64(2), sd, 1e-9)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_GetWindow(t *testing.T) {
+	a := NewTypedAggregator[string, int64]()
+	assert.Nil(t, a.Insert("key", 1))
+
+	_, err := a.GetWindow("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetPreviousWindow("key")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	a = NewTypedAggregator[string, int64](WithSlidingWindow(time.Hour, 60))
+	_, err = a.GetWindow("invalid")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, a.Insert("key", 1))
+	assert.Nil(t, a.Insert("key", 3))
+
+	w, err := a.GetWindow("key")
+	assert.Equal(t, int64(2), w.Count)
+	assert.Equal(t, int64(3), w.Max)
+	assert.Equal(t, int64(1), w.Min)
+	assert.Equal(t, int64(4), w.Sum)
+	assert.Nil(t, err)
+
+	w, err = a.GetPreviousWindow("key")
+	assert.Equal(t, int64(0), w.Count)
+	assert.Nil(t, err)
+}
+
+func TestTypedAggregator_Snapshot(t *testing.T) {
+	a := NewTypedAggregator[int, uint32]()
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, a.Insert(i, uint32(i)))
+		assert.Nil(t, a.Insert(i, uint32(i+2)))
+	}
+
+	snap := a.Snapshot()
+	assert.Equal(t, 4, len(snap))
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, TypedAggregate[uint32]{Avg: uint32(i + 1), Cnt: 2, Max: uint32(i + 2), Min: uint32(i), Sum: uint32(2*i + 2)}, snap[i])
+	}
+
+	assert.Equal(t, snap, a.SnapshotAndReset())
+	assert.Equal(t, 0, len(a.db))
+	assert.Equal(t, map[int]TypedAggregate[uint32]{}, a.Snapshot())
+}
@@ -0,0 +1,205 @@
+package aggregator
+
+import (
+	"math/big"
+	"math/cmplx"
+	"reflect"
+	"time"
+)
+
+// Value is implemented by custom types that can be inserted into an
+// Aggregator. The argument of Add and Less always has the same concrete type
+// as the receiver, and no method may modify its receiver or argument.
+//
+// The sum, average, minimum, maximum, count and duration of a custom key are
+// available. Functions that need a numeric value, such as rates, percentiles
+// and windows, return ErrNotSupported.
+type Value interface {
+	Add(Value) Value
+	Div(n int64) Value
+	Less(Value) bool
+	Zero() Value
+}
+
+// bigIntValue adapts *big.Int to Value.
+type bigIntValue big.Int
+
+func (b *bigIntValue) Add(v Value) Value {
+	return (*bigIntValue)(new(big.Int).Add((*big.Int)(b), (*big.Int)(v.(*bigIntValue))))
+}
+
+func (b *bigIntValue) Div(n int64) Value {
+	return (*bigIntValue)(new(big.Int).Quo((*big.Int)(b), big.NewInt(n)))
+}
+
+func (b *bigIntValue) Less(v Value) bool {
+	return (*big.Int)(b).Cmp((*big.Int)(v.(*bigIntValue))) < 0
+}
+
+func (b *bigIntValue) Zero() Value {
+	return new(bigIntValue)
+}
+
+// complexValue adapts complex64 and complex128 to Value. Complex values are
+// ordered by magnitude.
+type complexValue complex128
+
+func (c complexValue) Add(v Value) Value {
+	return c + v.(complexValue)
+}
+
+func (c complexValue) Div(n int64) Value {
+	return c / complexValue(complex(float64(n), 0))
+}
+
+func (c complexValue) Less(v Value) bool {
+	return cmplx.Abs(complex128(c)) < cmplx.Abs(complex128(v.(complexValue)))
+}
+
+func (c complexValue) Zero() Value {
+	return complexValue(0)
+}
+
+// customRecord is the record of a key whose values implement Value. Its
+// values are returned as the type of the first value inserted.
+type customRecord struct {
+	header
+	max Value
+	min Value
+	sum Value
+	typ reflect.Type
+}
+
+// newCustomRecord creates a record of weight values whose sum is value.
+func newCustomRecord(value Value, weight int64, typ reflect.Type, now time.Time) *customRecord {
+	each := perCustom(value, weight)
+	return &customRecord{
+		header: header{count: weight, time0: now, timeN: now},
+		max:    each,
+		min:    each,
+		sum:    value.Zero().Add(value),
+		typ:    typ,
+	}
+}
+
+// perCustom returns each of weight equal values whose sum is value.
+func perCustom(value Value, weight int64) Value {
+	if weight == 1 {
+		return value
+	}
+	return value.Div(weight)
+}
+
+func (r *customRecord) average() Value {
+	if r.count > 0 {
+		return r.sum.Div(r.count)
+	}
+	return r.sum
+}
+
+// original converts value to the type of the first value inserted. Big
+// integers are copied so that callers cannot modify the record.
+func (r *customRecord) original(value Value) interface{} {
+	if b, ok := value.(*bigIntValue); ok {
+		value = (*bigIntValue)(new(big.Int).Set((*big.Int)(b)))
+	}
+	return reflect.ValueOf(value).Convert(r.typ).Interface()
+}
+
+func (r *customRecord) anyAggregate() Aggregate {
+	return Aggregate{
+		Avg: r.original(r.average()),
+		Cnt: r.count,
+		Max: r.original(r.max),
+		Min: r.original(r.min),
+		Sum: r.original(r.sum),
+	}
+}
+
+func (r *customRecord) anyAverage() interface{} {
+	return r.original(r.average())
+}
+
+func (r *customRecord) anyCopy(opts *options) (anyRecord, error) {
+	c := *r
+	c.header = header{count: r.count, time0: r.time0, timeN: r.timeN}
+	return &c, nil
+}
+
+func (r *customRecord) anyInsert(value interface{}, weight int64, now time.Time, policy OverflowPolicy) error {
+	v := value.(Value)
+	each := perCustom(v, weight)
+
+	r.count += weight
+	r.sum = r.sum.Add(v)
+	r.stamp(now)
+
+	if each.Less(r.min) {
+		r.min = each
+	}
+
+	if r.max.Less(each) {
+		r.max = each
+	}
+
+	return nil
+}
+
+func (r *customRecord) anyMax() interface{} {
+	return r.original(r.max)
+}
+
+func (r *customRecord) anyMerge(other anyRecord, policy OverflowPolicy) error {
+	o := other.(*customRecord)
+
+	r.count += o.count
+	r.sum = r.sum.Add(o.sum)
+	r.stamp(o.time0)
+	r.stamp(o.timeN)
+
+	if o.min.Less(r.min) {
+		r.min = o.min
+	}
+
+	if r.max.Less(o.max) {
+		r.max = o.max
+	}
+
+	return nil
+}
+
+func (r *customRecord) anyMin() interface{} {
+	return r.original(r.min)
+}
+
+func (r *customRecord) anyInstantRate(dur time.Duration) (interface{}, error) {
+	return nil, ErrNotSupported
+}
+
+func (r *customRecord) anyRate(dur time.Duration) (interface{}, error) {
+	return nil, ErrNotSupported
+}
+
+func (r *customRecord) anyRateBetween(start, end time.Time, dur time.Duration) (interface{}, error) {
+	return nil, ErrNotSupported
+}
+
+func (r *customRecord) anySum() interface{} {
+	return r.original(r.sum)
+}
+
+func (r *customRecord) anyVariance() (float64, error) {
+	return 0, ErrNotSupported
+}
+
+func (r *customRecord) anyWindow(now time.Time, previous bool) (Aggregate, error) {
+	return Aggregate{}, ErrNotSupported
+}
+
+func (r *customRecord) getHistogram() (Histogram, error) {
+	return Histogram{}, ErrNotSupported
+}
+
+func (r *customRecord) percentile(q float64) (float64, error) {
+	return 0, ErrNotSupported
+}
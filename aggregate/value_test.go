@@ -0,0 +1,127 @@
+package aggregator
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type byteCounter struct {
+	bytes   uint64
+	packets uint64
+}
+
+func (b byteCounter) Add(v Value) Value {
+	return byteCounter{bytes: b.bytes + v.(byteCounter).bytes, packets: b.packets + v.(byteCounter).packets}
+}
+
+func (b byteCounter) Div(n int64) Value {
+	return byteCounter{bytes: b.bytes / uint64(n), packets: b.packets / uint64(n)}
+}
+
+func (b byteCounter) Less(v Value) bool {
+	return b.bytes < v.(byteCounter).bytes
+}
+
+func (b byteCounter) Zero() Value {
+	return byteCounter{}
+}
+
+func TestValue_BigInt(t *testing.T) {
+	a := NewAggregator()
+	x, _ := new(big.Int).SetString("100000000000000000000", 10)
+	y := big.NewInt(-1)
+
+	assert.Nil(t, a.Insert("key", x))
+	assert.Nil(t, a.Insert("key", y))
+	x.SetInt64(0) // Inserted values are copied
+
+	sum, err := a.GetSum("key")
+	assert.Equal(t, "99999999999999999999", sum.(*big.Int).String())
+	assert.Nil(t, err)
+
+	avg, err := a.GetAverage("key")
+	assert.Equal(t, "49999999999999999999", avg.(*big.Int).String())
+	assert.Nil(t, err)
+
+	max, err := a.GetMaximum("key")
+	assert.Equal(t, "100000000000000000000", max.(*big.Int).String())
+	assert.Nil(t, err)
+
+	min, err := a.GetMinimum("key")
+	assert.Equal(t, y, min)
+	assert.Nil(t, err)
+}
+
+func TestValue_BigIntCopy(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", big.NewInt(2)))
+	assert.Nil(t, a.Insert("key", big.NewInt(4)))
+
+	sum, _ := a.GetSum("key")
+	avg, _ := a.GetAverage("key")
+	max, _ := a.GetMaximum("key")
+	min, _ := a.GetMinimum("key")
+	agg, _ := a.Get("key")
+	snap := a.Snapshot()["key"]
+	for _, v := range []interface{}{sum, avg, max, min, agg.Avg, agg.Max, agg.Min, agg.Sum, snap.Max, snap.Sum} {
+		v.(*big.Int).SetInt64(-100) // Returned values are copied
+	}
+
+	agg, err := a.Get("key")
+	assert.Equal(t, "3", agg.Avg.(*big.Int).String())
+	assert.Equal(t, "4", agg.Max.(*big.Int).String())
+	assert.Equal(t, "2", agg.Min.(*big.Int).String())
+	assert.Equal(t, "6", agg.Sum.(*big.Int).String())
+	assert.Nil(t, err)
+}
+
+func TestValue_Complex(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("key", complex(3, 4)))
+	assert.Nil(t, a.Insert("key", complex(-1, 0)))
+	assert.ErrorIs(t, a.Insert("key", complex64(1)), ErrInvalid)
+
+	agg, err := a.Get("key")
+	assert.Equal(t, Aggregate{Avg: complex(1, 2), Cnt: int64(2), Max: complex(3, 4), Min: complex(-1, 0), Sum: complex(2, 4)}, agg)
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.Insert("key64", complex64(complex(1, 1))))
+	sum, err := a.GetSum("key64")
+	assert.Equal(t, complex64(complex(1, 1)), sum)
+	assert.Nil(t, err)
+}
+
+func TestValue_Custom(t *testing.T) {
+	a := NewAggregator()
+	assert.Nil(t, a.Insert("eth0", byteCounter{bytes: 1500, packets: 1}))
+	assert.Nil(t, a.Insert("eth0", byteCounter{bytes: 64000, packets: 48}))
+	assert.Nil(t, a.Insert("eth0", byteCounter{bytes: 64, packets: 1}))
+
+	agg, err := a.Get("eth0")
+	assert.Equal(t, Aggregate{
+		Avg: byteCounter{bytes: 21854, packets: 16},
+		Cnt: int64(3),
+		Max: byteCounter{bytes: 64000, packets: 48},
+		Min: byteCounter{bytes: 64, packets: 1},
+		Sum: byteCounter{bytes: 65564, packets: 50},
+	}, agg)
+	assert.Nil(t, err)
+
+	dur, err := a.GetDuration("eth0")
+	assert.True(t, dur > 0)
+	assert.Nil(t, err)
+
+	_, err = a.GetRate("eth0", time.Second)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetPercentile("eth0", 0.5)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetVariance("eth0")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetEWMA("eth0")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = a.GetWindow("eth0")
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
@@ -0,0 +1,107 @@
+package aggregator
+
+import (
+	"time"
+)
+
+// Window is the aggregate of the values inserted for a key between Start and
+// End.
+type Window[V Number] struct {
+	Start time.Time
+	End   time.Time
+	Count int64
+	Max   V
+	Min   V
+	Sum   V
+}
+
+func (w Window[V]) Average() V {
+	return averageOf(w.Sum, w.Count)
+}
+
+// Rate returns the sum of the window scaled to the duration dur.
+func (w Window[V]) Rate(dur time.Duration) (V, error) {
+	return rateOf(w.Sum, w.End.Sub(w.Start), dur)
+}
+
+type windowBucket[V Number] struct {
+	count int64
+	index int64
+	max   V
+	min   V
+	sum   V
+}
+
+// window is a ring of buckets that holds the current and previous windows of
+// a record. Each window spans bins buckets.
+type window[V Number] struct {
+	bins    int
+	buckets []windowBucket[V]
+	width   time.Duration
+}
+
+func newWindow[V Number](size time.Duration, bins int) *window[V] {
+	return &window[V]{
+		bins:    bins,
+		buckets: make([]windowBucket[V], 2*bins),
+		width:   size / time.Duration(bins),
+	}
+}
+
+func (w *window[V]) bucket(index int64) *windowBucket[V] {
+	n := int64(len(w.buckets))
+	return &w.buckets[((index%n)+n)%n]
+}
+
+func (w *window[V]) index(t time.Time) int64 {
+	return t.UnixNano() / int64(w.width)
+}
+
+// add inserts weight values whose sum is value.
+func (w *window[V]) add(value V, weight int64, now time.Time) {
+	i := w.index(now)
+	b := w.bucket(i)
+	each := perValue(value, weight)
+
+	switch {
+	case b.count == 0 || b.index < i:
+		*b = windowBucket[V]{count: weight, index: i, max: each, min: each, sum: value}
+	case b.index == i:
+		b.count += weight
+		b.sum, _ = addChecked(b.sum, value)
+		b.max = max(b.max, each)
+		b.min = min(b.min, each)
+	}
+}
+
+// aggregate returns the window that ends at now when previous is false, or
+// the completed window before it when previous is true.
+func (w *window[V]) aggregate(now time.Time, previous bool) Window[V] {
+	last := w.index(now)
+	if previous {
+		last -= int64(w.bins)
+	}
+	first := last - int64(w.bins) + 1
+
+	agg := Window[V]{
+		Start: time.Unix(0, first*int64(w.width)),
+		End:   now,
+	}
+	if previous {
+		agg.End = time.Unix(0, (last+1)*int64(w.width))
+	}
+
+	for i := first; i <= last; i++ {
+		if b := w.bucket(i); b.count > 0 && b.index == i {
+			if agg.Count == 0 {
+				agg.Max, agg.Min = b.max, b.min
+			} else {
+				agg.Max, agg.Min = max(agg.Max, b.max), min(agg.Min, b.min)
+			}
+			agg.Count += b.count
+			agg.Sum, _ = addChecked(agg.Sum, b.sum)
+		}
+	}
+
+	return agg
+}
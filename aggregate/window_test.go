@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Average(t *testing.T) {
+	assert.Equal(t, int64(0), Window[int64]{}.Average())
+	assert.Equal(t, int64(3), Window[int64]{Count: 2, Sum: 6}.Average())
+	assert.Equal(t, uint8(0), Window[uint8]{Count: 256, Sum: 100}.Average())
+	assert.Equal(t, int16(0), Window[int16]{Count: 1 << 16, Sum: -100}.Average())
+	assert.Equal(t, float32(0.5), Window[float32]{Count: 4, Sum: 2}.Average())
+}
+
+func TestWindow_Rate(t *testing.T) {
+	w := Window[uint64]{Start: time.Unix(10, 0), End: time.Unix(12, 0), Count: 4, Sum: 100}
+
+	rate, err := w.Rate(time.Second)
+	assert.Equal(t, uint64(50), rate)
+	assert.Nil(t, err)
+}
+
+func TestWindow_Sliding(t *testing.T) {
+	w := newWindow[int64](time.Minute, 6)
+	t0 := time.Unix(600, 0)
+
+	for i := 0; i < 12; i++ {
+		w.add(int64(i), 1, t0.Add(time.Duration(i)*10*time.Second))
+	}
+
+	// The current window holds the values inserted during the last minute
+	now := t0.Add(115 * time.Second)
+	cur := w.aggregate(now, false)
+	assert.Equal(t, t0.Add(60*time.Second), cur.Start)
+	assert.Equal(t, now, cur.End)
+	assert.Equal(t, int64(6), cur.Count)
+	assert.Equal(t, int64(11), cur.Max)
+	assert.Equal(t, int64(6), cur.Min)
+	assert.Equal(t, int64(51), cur.Sum)
+
+	prev := w.aggregate(now, true)
+	assert.Equal(t, t0, prev.Start)
+	assert.Equal(t, t0.Add(time.Minute), prev.End)
+	assert.Equal(t, int64(6), prev.Count)
+	assert.Equal(t, int64(5), prev.Max)
+	assert.Equal(t, int64(0), prev.Min)
+	assert.Equal(t, int64(15), prev.Sum)
+
+	// Buckets older than the previous window are expired
+	cur = w.aggregate(now.Add(time.Minute), false)
+	assert.Equal(t, int64(0), cur.Count)
+	prev = w.aggregate(now.Add(time.Minute), true)
+	assert.Equal(t, int64(6), prev.Count)
+	assert.Equal(t, int64(51), prev.Sum)
+}
+
+func TestWindow_Tumbling(t *testing.T) {
+	w := newWindow[float64](time.Second, 1)
+	t0 := time.Unix(100, 0)
+
+	w.add(1, 1, t0)
+	w.add(2, 1, t0.Add(500*time.Millisecond))
+	w.add(4, 1, t0.Add(time.Second))
+
+	cur := w.aggregate(t0.Add(1500*time.Millisecond), false)
+	assert.Equal(t, int64(1), cur.Count)
+	assert.Equal(t, float64(4), cur.Sum)
+
+	prev := w.aggregate(t0.Add(1500*time.Millisecond), true)
+	assert.Equal(t, int64(2), prev.Count)
+	assert.Equal(t, float64(3), prev.Sum)
+	assert.Equal(t, float64(2), prev.Max)
+	assert.Equal(t, float64(1), prev.Min)
+
+	// Values older than the ring are dropped
+	w.add(8, 1, t0.Add(-time.Second))
+	prev = w.aggregate(t0.Add(1500*time.Millisecond), true)
+	assert.Equal(t, float64(3), prev.Sum)
+}
+
+func TestWithSlidingWindow_Invalid(t *testing.T) {
+	assert.Panics(t, func() { WithSlidingWindow(time.Second, 0) })
+	assert.Panics(t, func() { WithTumblingWindow(0) })
+}
@@ -0,0 +1,97 @@
+package units
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var numberRegexp = regexp.MustCompile(`^([+-]?Inf|NaN|[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?)`)
+
+var quantities = struct {
+	mu  sync.RWMutex
+	set map[string]bool
+}{set: map[string]bool{"B": true, "b": true, "bit": true, "bps": true, "Hz": true, "s": true}}
+
+// RegisterQuantity adds symbol, such as "pkt", to the quantities understood
+// by Parse and ToNumber. The quantities B, b, bit, bps, Hz and s are always
+// registered.
+func RegisterQuantity(symbol string) {
+	if symbol == "" || strings.ContainsAny(symbol, "/ \t") {
+		panic("invalid quantity symbol: " + symbol)
+	}
+
+	quantities.mu.Lock()
+	quantities.set[symbol] = true
+	quantities.mu.Unlock()
+}
+
+// isQuantity returns whether q is a registered quantity or a ratio of two
+// registered quantities, such as B/s.
+func isQuantity(q string) bool {
+	quantities.mu.RLock()
+	defer quantities.mu.RUnlock()
+
+	num, den, ratio := strings.Cut(q, "/")
+	return quantities.set[num] && (!ratio || quantities.set[den])
+}
+
+// prefixValue returns the value of a binary or metric prefix, or zero if
+// prefix is unknown. The empty prefix has the value one.
+func prefixValue(prefix string) float64 {
+	if i := getBinaryPrefixIndex(prefix); i > -1 {
+		return binaryPrefix[i].val
+	} else if i = getMetricPrefixGe1Index(prefix); i > -1 {
+		return metricPrefixGe1[i].val
+	} else if i = getMetricPrefixLt1Index(prefix); i > -1 {
+		return metricPrefixLt1[i].val
+	} else if i = getMetricPrefixDecimalIndex(prefix); i > -1 {
+		return metricPrefixDecimal[i].val
+	}
+
+	return 0
+}
+
+// Parse splits s, such as "10 kB", "1.5 GiB/s", "100Mbps" or "250 ms", into
+// its number, its binary or metric prefix and its quantity. The number is
+// returned as written and is not scaled by the prefix, and may be +Inf, -Inf
+// or NaN as formatted by strconv. The prefix and the
+// quantity are optional, and the quantity must be registered or be a ratio
+// of registered quantities. A suffix that is both a quantity and a prefix
+// followed by a quantity is parsed as the quantity.
+func Parse(s string) (number float64, prefix, quantity string, err error) {
+	s = strings.TrimSpace(s)
+
+	loc := numberRegexp.FindStringIndex(s)
+	if loc == nil {
+		return 0, "", "", fmt.Errorf("invalid number: %q", s)
+	}
+
+	if number, err = strconv.ParseFloat(s[:loc[1]], 64); err != nil {
+		return 0, "", "", err
+	}
+
+	suffix := strings.TrimSpace(s[loc[1]:])
+	if suffix == "" || isQuantity(suffix) {
+		return number, "", suffix, nil
+	}
+
+	// The longest prefix wins, so that Mi is not parsed as M
+	for _, table := range [][]prefixPair{binaryPrefix[1:], metricPrefixGe1[1:], metricPrefixLt1[1:], metricPrefixDecimal[:]} {
+		for _, u := range table {
+			if len(u.sym) > len(prefix) && strings.HasPrefix(suffix, u.sym) {
+				if rest := suffix[len(u.sym):]; rest == "" || isQuantity(rest) {
+					prefix, quantity = u.sym, rest
+				}
+			}
+		}
+	}
+
+	if prefix == "" {
+		return 0, "", "", fmt.Errorf("invalid prefix or quantity: %q", suffix)
+	}
+
+	return number, prefix, quantity, nil
+}
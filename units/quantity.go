@@ -0,0 +1,240 @@
+package units
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a number of bytes. It is rendered with binary prefixes, such as
+// 1.5 GiB.
+type ByteSize float64
+
+// BitRate is a rate in bits per second. It is rendered with metric prefixes,
+// such as 100 Mbit/s.
+type BitRate float64
+
+// ByteRate is a rate in bytes per second. It is rendered with metric
+// prefixes, such as 12.5 MB/s.
+type ByteRate float64
+
+// Frequency is a frequency in hertz. It is rendered with metric prefixes,
+// such as 2.4 GHz.
+type Frequency float64
+
+// quantityType describes how a typed quantity is rendered and parsed.
+type quantityType struct {
+	accept []string // Quantities accepted by UnmarshalText
+	binary bool     // Render with binary prefixes
+	name   string   // Type name for %#v
+	symbol string   // Quantity rendered by String
+}
+
+var (
+	byteSizeType  = quantityType{accept: []string{"", "B"}, binary: true, name: "ByteSize", symbol: "B"}
+	bitRateType   = quantityType{accept: []string{"", "bit/s", "b/s", "bps"}, name: "BitRate", symbol: "bit/s"}
+	byteRateType  = quantityType{accept: []string{"", "B/s"}, name: "ByteRate", symbol: "B/s"}
+	frequencyType = quantityType{accept: []string{"", "Hz"}, name: "Frequency", symbol: "Hz"}
+)
+
+// string renders v with precision digits after the decimal point. A negative
+// precision renders up to three digits without trailing zeros.
+func (q *quantityType) string(v float64, precision int) string {
+	trim := precision < 0
+	if trim {
+		precision = 3
+	}
+
+	var s string
+	if q.binary {
+		s = ToBinaryString(v, precision, " ", q.symbol)
+	} else {
+		s = ToMetricString(v, precision, " ", q.symbol)
+	}
+
+	if number, unit, ok := strings.Cut(s, " "); ok && trim && strings.Contains(number, ".") {
+		s = strings.TrimRight(strings.TrimRight(number, "0"), ".") + " " + unit
+	}
+
+	return s
+}
+
+// format implements fmt.Formatter. The verbs v and s render the quantity like
+// String, f renders it with a fixed precision, the flag # of v renders it as
+// Go syntax and other verbs render the number without a prefix or quantity.
+func (q *quantityType) format(f fmt.State, verb rune, v float64) {
+	var s string
+	switch verb {
+	case 'v', 's':
+		if verb == 'v' && f.Flag('#') {
+			s = "units." + q.name + "(" + strconv.FormatFloat(v, 'g', -1, 64) + ")"
+		} else if precision, ok := f.Precision(); ok {
+			s = q.string(v, precision)
+		} else {
+			s = q.string(v, -1)
+		}
+	case 'f', 'F':
+		precision, ok := f.Precision()
+		if !ok {
+			precision = 6
+		}
+		s = q.string(v, precision)
+	default:
+		fmt.Fprintf(f, fmt.FormatString(f, verb), v)
+		return
+	}
+
+	if width, ok := f.Width(); ok && len([]rune(s)) < width {
+		pad := strings.Repeat(" ", width-len([]rune(s)))
+		if f.Flag('-') {
+			s += pad
+		} else {
+			s = pad + s
+		}
+	}
+
+	io.WriteString(f, s)
+}
+
+// marshal renders v exactly, without a prefix, so that it is parsed back to
+// the same value.
+func (q *quantityType) marshal(v float64) []byte {
+	return []byte(strconv.FormatFloat(v, 'g', -1, 64) + " " + q.symbol)
+}
+
+// unmarshal parses text, which may have any binary or metric prefix and one
+// of the accepted quantities.
+func (q *quantityType) unmarshal(text []byte) (float64, error) {
+	number, prefix, quantity, err := Parse(string(text))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, a := range q.accept {
+		if quantity == a {
+			return number * prefixValue(prefix), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid quantity for %s: %q", q.name, quantity)
+}
+
+// Bits returns the size in bits.
+func (b ByteSize) Bits() float64 {
+	return float64(b) * 8
+}
+
+func (b ByteSize) Format(f fmt.State, verb rune) {
+	byteSizeType.format(f, verb, float64(b))
+}
+
+// MarshalText encodes the size in bytes, such as 1536 B.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return byteSizeType.marshal(float64(b)), nil
+}
+
+// Per returns the rate at which the size is transferred over the duration d.
+func (b ByteSize) Per(d time.Duration) ByteRate {
+	return ByteRate(float64(b) / d.Seconds())
+}
+
+func (b ByteSize) String() string {
+	return byteSizeType.string(float64(b), -1)
+}
+
+// UnmarshalText decodes a size such as 1536, 1.5 KiB or 10 MB.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	v, err := byteSizeType.unmarshal(text)
+	if err == nil {
+		*b = ByteSize(v)
+	}
+	return err
+}
+
+// ByteRate returns the rate in bytes per second.
+func (r BitRate) ByteRate() ByteRate {
+	return ByteRate(r / 8)
+}
+
+func (r BitRate) Format(f fmt.State, verb rune) {
+	bitRateType.format(f, verb, float64(r))
+}
+
+// MarshalText encodes the rate in bits per second, such as 1e+08 bit/s.
+func (r BitRate) MarshalText() ([]byte, error) {
+	return bitRateType.marshal(float64(r)), nil
+}
+
+func (r BitRate) String() string {
+	return bitRateType.string(float64(r), -1)
+}
+
+// UnmarshalText decodes a rate such as 100 Mbit/s, 100 Mb/s or 100Mbps.
+func (r *BitRate) UnmarshalText(text []byte) error {
+	v, err := bitRateType.unmarshal(text)
+	if err == nil {
+		*r = BitRate(v)
+	}
+	return err
+}
+
+// BitRate returns the rate in bits per second.
+func (r ByteRate) BitRate() BitRate {
+	return BitRate(r * 8)
+}
+
+func (r ByteRate) Format(f fmt.State, verb rune) {
+	byteRateType.format(f, verb, float64(r))
+}
+
+// MarshalText encodes the rate in bytes per second, such as 1.25e+07 B/s.
+func (r ByteRate) MarshalText() ([]byte, error) {
+	return byteRateType.marshal(float64(r)), nil
+}
+
+// Over returns the size transferred at the rate over the duration d.
+func (r ByteRate) Over(d time.Duration) ByteSize {
+	return ByteSize(float64(r) * d.Seconds())
+}
+
+func (r ByteRate) String() string {
+	return byteRateType.string(float64(r), -1)
+}
+
+// UnmarshalText decodes a rate such as 12.5 MB/s or 1 GiB/s.
+func (r *ByteRate) UnmarshalText(text []byte) error {
+	v, err := byteRateType.unmarshal(text)
+	if err == nil {
+		*r = ByteRate(v)
+	}
+	return err
+}
+
+func (f Frequency) Format(s fmt.State, verb rune) {
+	frequencyType.format(s, verb, float64(f))
+}
+
+// MarshalText encodes the frequency in hertz, such as 2.4e+09 Hz.
+func (f Frequency) MarshalText() ([]byte, error) {
+	return frequencyType.marshal(float64(f)), nil
+}
+
+// Period returns the duration of one cycle.
+func (f Frequency) Period() time.Duration {
+	return time.Duration(float64(time.Second) / float64(f))
+}
+
+func (f Frequency) String() string {
+	return frequencyType.string(float64(f), -1)
+}
+
+// UnmarshalText decodes a frequency such as 2.4 GHz.
+func (f *Frequency) UnmarshalText(text []byte) error {
+	v, err := frequencyType.unmarshal(text)
+	if err == nil {
+		*f = Frequency(v)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package units
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantity_String(t *testing.T) {
+	assert.Equal(t, "0 B", ByteSize(0).String())
+	assert.Equal(t, "1.5 KiB", ByteSize(1536).String())
+	assert.Equal(t, "117.738 MiB", ByteSize(123456789).String())
+	assert.Equal(t, "100 Mbit/s", BitRate(1e8).String())
+	assert.Equal(t, "12.5 MB/s", ByteRate(12.5e6).String())
+	assert.Equal(t, "2.4 GHz", Frequency(2.4e9).String())
+	assert.Equal(t, "-1 KiB", ByteSize(-1024).String())
+}
+
+func TestQuantity_Format(t *testing.T) {
+	assert.Equal(t, "1.5 KiB", fmt.Sprintf("%v", ByteSize(1536)))
+	assert.Equal(t, "1.50 KiB", fmt.Sprintf("%.2f", ByteSize(1536)))
+	assert.Equal(t, "1.500000 KiB", fmt.Sprintf("%f", ByteSize(1536)))
+	assert.Equal(t, "units.ByteSize(1536)", fmt.Sprintf("%#v", ByteSize(1536)))
+	assert.Equal(t, "units.BitRate(1e+08)", fmt.Sprintf("%#v", BitRate(1e8)))
+	assert.Equal(t, "   1.5 KiB|", fmt.Sprintf("%10s|", ByteSize(1536)))
+	assert.Equal(t, "1.5 KiB   |", fmt.Sprintf("%-10v|", ByteSize(1536)))
+	assert.Equal(t, "1536", fmt.Sprintf("%g", ByteSize(1536)))
+	assert.Equal(t, "[2.4 GHz 12.5 MB/s]", fmt.Sprint([]interface{}{Frequency(2.4e9), ByteRate(12.5e6)}))
+}
+
+func TestQuantity_MarshalText(t *testing.T) {
+	type config struct {
+		Clock  Frequency
+		Link   BitRate
+		Limit  ByteRate
+		Memory ByteSize
+	}
+
+	in := config{Clock: 2.4e9, Link: 1e8, Limit: 12.5e6, Memory: 123456789}
+	data, err := json.Marshal(in)
+	assert.Equal(t, `{"Clock":"2.4e+09 Hz","Link":"1e+08 bit/s","Limit":"1.25e+07 B/s","Memory":"1.23456789e+08 B"}`, string(data))
+	assert.Nil(t, err)
+
+	var out config
+	assert.Nil(t, json.Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"Clock":"2.4 GHz","Link":"100Mbps","Limit":"1 GiB/s","Memory":"1.5 KiB"}`), &out))
+	assert.Equal(t, config{Clock: 2.4e9, Link: 1e8, Limit: 1 << 30, Memory: 1536}, out)
+}
+
+func TestQuantity_MarshalText_NonFinite(t *testing.T) {
+	for _, v := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		data, err := json.Marshal(ByteSize(v))
+		assert.Nil(t, err)
+
+		var size ByteSize
+		assert.Nil(t, json.Unmarshal(data, &size))
+		assert.True(t, float64(size) == v || math.IsNaN(v) && math.IsNaN(float64(size)), string(data))
+	}
+}
+
+func TestQuantity_UnmarshalText(t *testing.T) {
+	var size ByteSize
+	assert.Nil(t, size.UnmarshalText([]byte("10 kB")))
+	assert.Equal(t, ByteSize(10000), size)
+	assert.Nil(t, size.UnmarshalText([]byte("512")))
+	assert.Equal(t, ByteSize(512), size)
+	assert.NotNil(t, size.UnmarshalText([]byte("10 kbit")))
+	assert.NotNil(t, size.UnmarshalText([]byte("10 kB/s")))
+	assert.Equal(t, ByteSize(512), size)
+
+	var rate BitRate
+	assert.Nil(t, rate.UnmarshalText([]byte("100 Mb/s")))
+	assert.Equal(t, BitRate(1e8), rate)
+	assert.NotNil(t, rate.UnmarshalText([]byte("100 MB/s")))
+
+	var freq Frequency
+	assert.NotNil(t, freq.UnmarshalText([]byte("2.4 GB")))
+}
+
+func TestQuantity_Conversion(t *testing.T) {
+	assert.Equal(t, float64(8192), ByteSize(1024).Bits())
+	assert.Equal(t, ByteRate(12.5e6), BitRate(1e8).ByteRate())
+	assert.Equal(t, BitRate(1e8), ByteRate(12.5e6).BitRate())
+	assert.Equal(t, ByteRate(512), ByteSize(1024).Per(2*time.Second))
+	assert.Equal(t, ByteSize(2048), ByteRate(1024).Over(2*time.Second))
+	assert.Equal(t, 400*time.Nanosecond, Frequency(2.5e6).Period())
+}
@@ -1,13 +1,9 @@
 package units
 
 import (
-	"errors"
 	"fmt"
-	"io"
 	"math"
 	"strconv"
-	"strings"
-	"unicode/utf8"
 )
 
 type prefixPair struct {
@@ -45,8 +41,6 @@ var metricPrefixLt1 = [...]prefixPair{
 
 var metricPrefixGe1 = [...]prefixPair{
 	{sym: "", val: math.Pow(10, 0)},
-	//{sym: "da", val: math.Pow(10, 1)},
-	//{sym: "h", val: math.Pow(10, 2)},
 	{sym: "k", val: math.Pow(10, 3)},
 	{sym: "M", val: math.Pow(10, 6)},
 	{sym: "G", val: math.Pow(10, 9)},
@@ -59,6 +53,13 @@ var metricPrefixGe1 = [...]prefixPair{
 	{sym: "Q", val: math.Pow(10, 30)},
 }
 
+// metricPrefixDecimal holds the metric prefixes that are not powers of 1000,
+// which are parsed and may be requested but are never chosen automatically.
+var metricPrefixDecimal = [...]prefixPair{
+	{sym: "da", val: math.Pow(10, 1)},
+	{sym: "h", val: math.Pow(10, 2)},
+}
+
 var timePrefix = [...]prefixPair{
 	{sym: "%.0f.", val: 86400},
 	{sym: "%02.0f:", val: 3600},
@@ -76,6 +77,16 @@ func getBinaryPrefixIndex(prefix string) int {
 	return -1
 }
 
+func getMetricPrefixDecimalIndex(prefix string) int {
+	for i, u := range metricPrefixDecimal {
+		if prefix == u.sym {
+			return i
+		}
+	}
+
+	return -1
+}
+
 func getMetricPrefixGe1Index(prefix string) int {
 	for i, u := range metricPrefixGe1 {
 		if prefix == u.sym {
@@ -151,6 +162,9 @@ func ToMetricStringWithPrefix(number float64, precision int, separator, returnPr
 	} else if i = getMetricPrefixLt1Index(returnPrefix); i > -1 { // Return desired metric prefix
 		n /= metricPrefixLt1[i].val
 		symbol = metricPrefixLt1[i].sym
+	} else if i = getMetricPrefixDecimalIndex(returnPrefix); i > -1 { // Return desired metric prefix
+		n /= metricPrefixDecimal[i].val
+		symbol = metricPrefixDecimal[i].sym
 	} else { // Convert to appropriate metric prefix that keeps unit value in the range [1, 1000)
 
 		if n == 0 {
@@ -182,50 +196,15 @@ func ToMetricStringWithPrefix(number float64, precision int, separator, returnPr
 	return strconv.FormatFloat(sfactor*n, 'f', precision, 64) + separator + symbol + quantity
 }
 
+// ToNumber parses s, such as "1.5 GiB/s", and returns its number scaled by
+// its prefix. The quantity, if any, must be registered.
 func ToNumber(s string) (float64, error) {
-	var (
-		f      float64
-		prefix string
-	)
-
-	n, err := fmt.Sscanf(s, "%f%s", &f, &prefix)
+	f, prefix, _, err := Parse(s)
 	if err != nil {
-		switch {
-		case errors.Is(err, io.EOF) && n == 1:
-			return f, nil
-		default:
-			return 0, err
-		}
-	}
-
-	if n == 2 {
-		prefix = strings.TrimSpace(prefix)
-		switch utf8.RuneCountInString(prefix) {
-		case 0:
-			return f, nil
-		case 1: // Metric prefix (e.g., k)
-			for _, u := range metricPrefixGe1 {
-				if u.sym == prefix {
-					return f * u.val, nil
-				}
-			}
-
-			for _, u := range metricPrefixLt1 {
-				if u.sym == prefix {
-					return f * u.val, nil
-				}
-			}
-		case 2: // Binary prefix (e.g., Ki)
-			for _, u := range binaryPrefix {
-				if u.sym == prefix {
-					return f * u.val, nil
-				}
-			}
-		}
-		return 0, fmt.Errorf("invalid prefix: " + prefix)
+		return 0, err
 	}
 
-	return f, nil
+	return f * prefixValue(prefix), nil
 }
 
 func ToTimeString(durationInSeconds float64) string {
@@ -100,6 +100,7 @@ func TestToMetricStringWithPrefix(t *testing.T) {
 		{expectedStr: "123456.789 kB", number: 123456789, precision: 3, prefix: "k", quantity: "B", separator: " "},
 		{expectedStr: "123.457 MB", number: 123456789, precision: 3, prefix: "M", quantity: "B", separator: " "},
 		{expectedStr: "0.123 GB", number: 123456789, precision: 3, prefix: "G", quantity: "B", separator: " "},
+		{expectedStr: "1234567.890 hB", number: 123456789, precision: 3, prefix: "h", quantity: "B", separator: " "},
 	}
 
 	for _, test := range tests {
@@ -129,6 +130,15 @@ func TestUnitsToNumber(t *testing.T) {
 		{expectErr: false, expectedNum: 1234, str: "1.234 k"},
 		{expectErr: false, expectedNum: 1263.616, str: "1.234Ki"},
 		{expectErr: false, expectedNum: 1263.616, str: "1.234 Ki"},
+		{expectErr: false, expectedNum: 10000, str: "10 kB"},
+		{expectErr: false, expectedNum: 1.5 * math.Pow(1024, 3), str: "1.5 GiB/s"},
+		{expectErr: false, expectedNum: 100 * math.Pow(10, 6), str: "100Mbps"},
+		{expectErr: false, expectedNum: 250 * math.Pow(10, -3), str: "250 ms"},
+		{expectErr: false, expectedNum: 50, str: "5da"},
+		{expectErr: false, expectedNum: 200, str: "2 h"},
+		{expectErr: false, expectedNum: 60, str: "60 Hz"},
+		{expectErr: true, expectedNum: 0, str: "10 kX"},
+		{expectErr: true, expectedNum: 0, str: "k"},
 	}
 
 	for _, test := range tests {
@@ -141,6 +151,60 @@ func TestUnitsToNumber(t *testing.T) {
 	}
 }
 
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expectErr bool
+		number    float64
+		prefix    string
+		quantity  string
+		str       string
+	}{
+		{number: 123, str: "123"},
+		{number: -1.5, quantity: "B", str: " -1.5B "},
+		{number: 10, prefix: "k", quantity: "B", str: "10 kB"},
+		{number: 1.5, prefix: "Gi", quantity: "B/s", str: "1.5 GiB/s"},
+		{number: 100, prefix: "M", quantity: "bps", str: "100Mbps"},
+		{number: 250, prefix: "m", quantity: "s", str: "250 ms"},
+		{number: 3, prefix: "μ", quantity: "s", str: "3μs"},
+		{number: 2, prefix: "Mi", str: "2 Mi"},
+		{number: 1e3, prefix: "E", quantity: "bit", str: "1e3 Ebit"},
+		{number: 5, prefix: "da", quantity: "Hz", str: "5 daHz"},
+		{number: 7, prefix: "h", str: "7h"},
+		{number: math.Inf(1), quantity: "B", str: "+Inf B"},
+		{number: math.Inf(-1), prefix: "Ki", quantity: "B", str: "-Inf KiB"},
+		{expectErr: true, str: ""},
+		{expectErr: true, str: "kB"},
+		{expectErr: true, str: "10 kB/x"},
+		{expectErr: true, str: "10 KB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			number, prefix, quantity, err := Parse(test.str)
+			if assert.Equal(t, test.expectErr, err != nil) && err == nil {
+				assert.Equal(t, test.number, number)
+				assert.Equal(t, test.prefix, prefix)
+				assert.Equal(t, test.quantity, quantity)
+			}
+		})
+	}
+}
+
+func TestRegisterQuantity(t *testing.T) {
+	_, _, _, err := Parse("10 kpkt/s")
+	assert.NotNil(t, err)
+
+	RegisterQuantity("pkt")
+	number, prefix, quantity, err := Parse("10 kpkt/s")
+	assert.Equal(t, float64(10), number)
+	assert.Equal(t, "k", prefix)
+	assert.Equal(t, "pkt/s", quantity)
+	assert.Nil(t, err)
+
+	assert.Panics(t, func() { RegisterQuantity("") })
+	assert.Panics(t, func() { RegisterQuantity("B/s") })
+}
+
 func TestToTimeString(t *testing.T) {
 	tests := []struct {
 		durationInSeconds float64